@@ -7,6 +7,7 @@ import (
 	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/internal/i18n"
 	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/notification/hasspanel"
 	sparkplugb_client "github.com/mtrossbach/waechter/notification/sparkplugb-client"
 	"github.com/mtrossbach/waechter/notification/whatsapp"
 	"github.com/mtrossbach/waechter/system"
@@ -54,6 +55,12 @@ func main() {
 		}
 	}
 
+	if p := config.HassPanel(); p != nil {
+		if err := hasspanel.NewPanel(*p, waechter).Start(); err != nil {
+			log.Error().Err(err).Msg("Could not start Home Assistant panel.")
+		}
+	}
+
 	log.Info().Msg("Started.")
 
 	cancelChan := make(chan os.Signal, 1)
@@ -0,0 +1,121 @@
+package homeassistant
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/i18n"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/device"
+	"strings"
+)
+
+type serviceCall struct {
+	domain   string
+	service  string
+	data     map[string]any
+	entityId string
+}
+
+// actorsForDomain returns the actors of an entity or notify service. Lights, switches and notify services
+// are only controlled when configured, sirens are always used.
+func actorsForDomain(domain string, configured bool) []device.Actor {
+	switch domain {
+	case "siren":
+		return []device.Actor{device.AlarmActor, device.NotificationShortActor, device.NotificationLongActor}
+	case "light", "switch", "notify":
+		if configured {
+			return []device.Actor{device.AlarmActor}
+		}
+	}
+	return nil
+}
+
+func domain(entityId string) string {
+	if i := strings.Index(entityId, "."); i > 0 {
+		return entityId[:i]
+	}
+	return entityId
+}
+
+// actorConfig returns the configuration of an entity or notify service, or an empty configuration.
+func (c *Connector) actorConfig(target string) (config.HomeAssistantActorConfig, bool) {
+	for _, a := range c.conf.Actors {
+		if a.Entity == target || a.Service == target {
+			return a, true
+		}
+	}
+	return config.HomeAssistantActorConfig{}, false
+}
+
+// serviceCalls maps an actor to the service calls of the target entity or notify service.
+func (c *Connector) serviceCalls(target string, actor device.Actor) []serviceCall {
+	conf, _ := c.actorConfig(target)
+	a := c.actorAlarm()
+
+	switch domain(target) {
+	case "siren":
+		switch actor {
+		case device.AlarmActor:
+			if a == alarm.None || a.IsPending() {
+				return []serviceCall{{domain: "siren", service: "turn_off", entityId: target}}
+			}
+			return []serviceCall{{domain: "siren", service: "turn_on", data: sirenData(conf, conf.Duration), entityId: target}}
+		case device.NotificationShortActor:
+			return []serviceCall{{domain: "siren", service: "turn_on", data: sirenData(conf, 1), entityId: target}}
+		case device.NotificationLongActor:
+			return []serviceCall{{domain: "siren", service: "turn_on", data: sirenData(conf, 3), entityId: target}}
+		}
+
+	case "light":
+		if actor == device.AlarmActor && a != alarm.None && !a.IsPending() {
+			flash := conf.Flash
+			if len(flash) == 0 {
+				flash = "long"
+			}
+			return []serviceCall{{domain: "light", service: "turn_on", data: map[string]any{"flash": flash}, entityId: target}}
+		}
+
+	case "switch":
+		if actor == device.AlarmActor {
+			if a == alarm.None || a.IsPending() {
+				return []serviceCall{{domain: "switch", service: "turn_off", entityId: target}}
+			}
+			return []serviceCall{{domain: "switch", service: "turn_on", entityId: target}}
+		}
+
+	case "notify":
+		if actor == device.AlarmActor && a != alarm.None && !a.IsPending() {
+			lang := conf.Lang
+			if len(lang) == 0 {
+				lang = "en"
+			}
+			return []serviceCall{{domain: "notify", service: strings.TrimPrefix(target, "notify."), data: map[string]any{
+				"title":   config.General().Name,
+				"message": i18n.TranslateAlarm(lang, a),
+			}}}
+		}
+	}
+	return nil
+}
+
+func sirenData(conf config.HomeAssistantActorConfig, duration int) map[string]any {
+	data := map[string]any{}
+	if len(conf.Tone) > 0 {
+		data["tone"] = conf.Tone
+	}
+	if conf.VolumeLevel > 0 {
+		data["volume_level"] = conf.VolumeLevel
+	}
+	if duration > 0 {
+		data["duration"] = duration
+	}
+	return data
+}
+
+// actorAlarm returns the alarm actors should signal, which is none while the alarm is silenced.
+func (c *Connector) actorAlarm() alarm.Type {
+	state := c.ctrl.SystemState()
+	if state.Silenced {
+		return alarm.None
+	}
+	return state.Alarm
+}
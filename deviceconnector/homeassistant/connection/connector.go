@@ -14,15 +14,28 @@ import (
 type LostHandler func(conn *Connection, err error)
 type ConnectedHandler func(conn *Connection)
 
-type StateEventHandler func(entityId string, event msgs.EventResponse)
+// StateEventHandler receives the state changes of an entity, missed is set for changes that happened while the
+// connection was lost.
+type StateEventHandler func(entityId string, state msgs.SensorState, missed bool)
+type EventHandler func(event msgs.EventResponse)
 
 type Connection struct {
-	ws         *websocket.Conn
-	cmd        sync.Map
-	evt        sync.Map
-	connection bool
-	seq        uint64
-	writerChan chan any
+	ws  *websocket.Conn
+	cmd sync.Map
+	// subscriptions survive reconnects, they are subscribed again after every authentication
+	subscriptions     sync.Map      // map[uint64]*eventSubscription
+	stateHandlers     sync.Map      // map[string]StateEventHandler
+	stateSubscription atomic.Uint64 // id of the subscribe_entities subscription, 0 if not subscribed
+	restoredStates    atomic.Uint64 // id of the state subscription restored after the last reconnect
+	stateTimer        *time.Timer
+	entityStates      map[string]msgs.CompressedState // kept across reconnects to find the changes missed meanwhile
+	entityMutex       sync.Mutex
+	subscriptionMutex sync.Mutex
+	subscriptionSeq   uint64
+	authenticated     bool
+	connection        bool
+	seq               uint64
+	writerChan        chan any
 
 	conId            uint64
 	url              string
@@ -32,16 +45,17 @@ type Connection struct {
 }
 
 func NewConnection(url string, token string) *Connection {
-	return &Connection{
+	c := &Connection{
 		url:   url,
 		token: token,
 		conId: 0,
-		evt:   sync.Map{},
 	}
+	return c
 }
 
 func (c *Connection) Connect() {
 	c.cmd = sync.Map{}
+	c.resetSubscriptions()
 	c.seq = 0
 	c.conId += 1
 	c.writerChan = make(chan any)
@@ -123,23 +137,9 @@ func (c *Connection) handleMessage(msg []byte, token string) {
 	case msgs.AuthOk:
 		log.Debug().Msg("HomeAssistant authentication successful")
 		go c.writerPump()
+		go c.restoreSubscriptions()
 	case msgs.Event:
-
-		var event msgs.EventResponse
-		err := json.Unmarshal(msg, &event)
-		if err != nil {
-			log.Error().RawJSON("msg", msg).Err(err).Msg("Could not parse EventResponse")
-			return
-		}
-
-		h, ok := c.evt.Load(event.Event.Variables.Trigger.EntityID)
-		if ok {
-			s := h.(subscription)
-			s.handler(event.Event.Variables.Trigger.EntityID, event)
-			return
-		} else {
-			log.Error().RawJSON("msg", msg).Msg("Received EventResponse but did not find a handler")
-		}
+		c.handleEvent(result.Id, msg)
 
 	default:
 		ch, ok := c.cmd.Load(result.Id)
@@ -183,6 +183,8 @@ func (c *Connection) basicCommand(id uint64, payload SetId) error {
 	}
 	if result.Success != nil && *result.Success == true {
 		return nil
+	} else if result.Error == nil {
+		return remoteError{Code: "unknown"}
 	} else {
 		return remoteError{
 			Code:    result.Error.Code,
@@ -197,48 +199,21 @@ func (c *Connection) Command(payload SetId, result any) error {
 	return c.command(id, payload, result)
 }
 
-func (c *Connection) SubscribeStateEvents(entityId string, handler StateEventHandler) error {
-	if _, exists := c.evt.Load(entityId); exists {
-		if err := c.UnsubscribeStateEvents(entityId); err != nil {
-			return err
-		}
-	}
-
+func (c *Connection) CallService(domain string, service string, data map[string]any, entityId string) error {
 	seqId := c.nextSeq()
-	payload := msgs.SubscribeStateRequest{
+	payload := msgs.CallServiceRequest{
 		BaseMessage: msgs.BaseMessage{
-			Type: msgs.SubscribeTrigger,
+			Type: msgs.CallService,
 			Id:   seqId,
 		},
-		Trigger: msgs.TriggerDetails{
-			Platform: "state",
-			EntityID: entityId,
-		},
+		Domain:      domain,
+		Service:     service,
+		ServiceData: data,
 	}
-	c.evt.Store(entityId, subscription{
-		handler: handler,
-		seqId:   seqId,
-	})
-
-	err := c.basicCommand(seqId, &payload)
-	return err
-}
-
-func (c *Connection) UnsubscribeStateEvents(entityId string) error {
-	if s, exists := c.evt.Load(entityId); exists {
-		payload := msgs.UnsubscribeRequest{
-			BaseMessage: msgs.BaseMessage{
-				Type: msgs.UnsubscribeEvents,
-			},
-			Subscription: s.(subscription).seqId,
-		}
-
-		c.evt.Delete(entityId)
-		seqId := c.nextSeq()
-		payload.SetId(seqId)
-		return c.basicCommand(seqId, &payload)
+	if len(entityId) > 0 {
+		payload.Target = &msgs.ServiceTarget{EntityID: entityId}
 	}
-	return nil
+	return c.basicCommand(seqId, &payload)
 }
 
 func (c *Connection) writerPump() {
@@ -1,8 +1,11 @@
 package connection
 
-type subscription struct {
-	handler StateEventHandler
-	seqId   uint64
+import "sync/atomic"
+
+type eventSubscription struct {
+	eventType string
+	handler   EventHandler
+	remoteId  atomic.Uint64 // id of the subscription on the current connection, 0 if not subscribed
 }
 
 type SetId interface {
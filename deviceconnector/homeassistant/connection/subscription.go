@@ -0,0 +1,265 @@
+package connection
+
+import (
+	"encoding/json"
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
+	"github.com/mtrossbach/waechter/internal/log"
+	"sort"
+	"time"
+)
+
+// stateSubscriptionDelay collects the changes of the subscribed entities, e.g. while the devices are activated,
+// into a single resubscription.
+const stateSubscriptionDelay = 200 * time.Millisecond
+
+// SubscribeStateEvents registers the handler for state changes of the entity. The entities with a handler are
+// subscribed together with subscribe_entities, the subscription is replaced shortly after the set changed.
+func (c *Connection) SubscribeStateEvents(entityId string, handler StateEventHandler) {
+	c.stateHandlers.Store(entityId, handler)
+	c.scheduleStateSubscription()
+}
+
+func (c *Connection) UnsubscribeStateEvents(entityId string) {
+	c.stateHandlers.Delete(entityId)
+	c.scheduleStateSubscription()
+}
+
+func (c *Connection) scheduleStateSubscription() {
+	c.subscriptionMutex.Lock()
+	defer c.subscriptionMutex.Unlock()
+
+	// restoreSubscriptions subscribes after the authentication
+	if !c.authenticated {
+		return
+	}
+	if c.stateTimer != nil {
+		c.stateTimer.Stop()
+	}
+	c.stateTimer = time.AfterFunc(stateSubscriptionDelay, func() { c.subscribeStates(false) })
+}
+
+// subscribeStates replaces the state subscription by one for the entities with a handler. The new subscription
+// is made before the old one is removed, changes in between are found by comparing its initial states. After a
+// reconnect (restored) these changes were missed while the connection was lost.
+func (c *Connection) subscribeStates(restored bool) {
+	c.subscriptionMutex.Lock()
+	authenticated := c.authenticated
+	c.subscriptionMutex.Unlock()
+	if !authenticated {
+		return
+	}
+
+	var entityIds []string
+	c.stateHandlers.Range(func(key, _ any) bool {
+		entityIds = append(entityIds, key.(string))
+		return true
+	})
+	sort.Strings(entityIds)
+
+	var old uint64
+	if len(entityIds) > 0 {
+		seqId := c.nextSeq()
+		payload := msgs.SubscribeEntitiesRequest{
+			BaseMessage: msgs.BaseMessage{
+				Type: msgs.SubscribeEntities,
+				Id:   seqId,
+			},
+			EntityIds: entityIds,
+		}
+
+		// the ids are set before the command, events may arrive before its result
+		if restored {
+			c.restoredStates.Store(seqId)
+		}
+		old = c.stateSubscription.Swap(seqId)
+		if err := c.basicCommand(seqId, &payload); err != nil {
+			c.stateSubscription.CompareAndSwap(seqId, old)
+			log.Error().Err(err).Msg("Could not subscribe to HomeAssistant state changes")
+			return
+		}
+	} else {
+		// an empty entity filter would subscribe all entities
+		old = c.stateSubscription.Swap(0)
+	}
+
+	if old != 0 {
+		if err := c.unsubscribe(old); err != nil {
+			log.Error().Err(err).Msg("Could not unsubscribe from HomeAssistant state changes")
+		}
+	}
+}
+
+// SubscribeEvents subscribes to all events of the type, e.g. zha_event, and returns the id of the subscription.
+// The subscription is kept across reconnects.
+func (c *Connection) SubscribeEvents(eventType string, handler EventHandler) (uint64, error) {
+	c.subscriptionMutex.Lock()
+	c.subscriptionSeq++
+	id := c.subscriptionSeq
+	s := &eventSubscription{eventType: eventType, handler: handler}
+	c.subscriptions.Store(id, s)
+	authenticated := c.authenticated
+	c.subscriptionMutex.Unlock()
+
+	if authenticated {
+		return id, c.subscribe(s)
+	}
+	return id, nil
+}
+
+func (c *Connection) UnsubscribeEvents(id uint64) error {
+	c.subscriptionMutex.Lock()
+	s, exists := c.subscriptions.LoadAndDelete(id)
+	authenticated := c.authenticated
+	c.subscriptionMutex.Unlock()
+
+	if !exists || !authenticated {
+		return nil
+	}
+	if remoteId := s.(*eventSubscription).remoteId.Swap(0); remoteId != 0 {
+		return c.unsubscribe(remoteId)
+	}
+	return nil
+}
+
+// subscribe subscribes the events unless they are subscribed already, e.g. by restoreSubscriptions.
+func (c *Connection) subscribe(s *eventSubscription) error {
+	seqId := c.nextSeq()
+	payload := msgs.SubscribeEventsRequest{
+		BaseMessage: msgs.BaseMessage{
+			Type: msgs.SubscribeEvents,
+			Id:   seqId,
+		},
+		EventType: s.eventType,
+	}
+
+	// the id is set before the command, events may arrive before its result
+	if !s.remoteId.CompareAndSwap(0, seqId) {
+		return nil
+	}
+	if err := c.basicCommand(seqId, &payload); err != nil {
+		s.remoteId.CompareAndSwap(seqId, 0)
+		return err
+	}
+	return nil
+}
+
+func (c *Connection) unsubscribe(remoteId uint64) error {
+	seqId := c.nextSeq()
+	payload := msgs.UnsubscribeRequest{
+		BaseMessage: msgs.BaseMessage{
+			Type: msgs.UnsubscribeEvents,
+			Id:   seqId,
+		},
+		Subscription: remoteId,
+	}
+	return c.basicCommand(seqId, &payload)
+}
+
+// resetSubscriptions forgets the subscriptions of the last connection. The entity states are kept, so that the
+// initial states of the restored subscription show the changes missed while the connection was lost.
+func (c *Connection) resetSubscriptions() {
+	c.subscriptionMutex.Lock()
+	c.authenticated = false
+	if c.stateTimer != nil {
+		c.stateTimer.Stop()
+	}
+	c.subscriptionMutex.Unlock()
+
+	c.stateSubscription.Store(0)
+	c.subscriptions.Range(func(_, value any) bool {
+		value.(*eventSubscription).remoteId.Store(0)
+		return true
+	})
+}
+
+// restoreSubscriptions subscribes to state changes and all events again after authentication. The commands are
+// sent without holding the lock, as they block until their result arrives.
+func (c *Connection) restoreSubscriptions() {
+	c.subscriptionMutex.Lock()
+	c.authenticated = true
+	var subscriptions []*eventSubscription
+	c.subscriptions.Range(func(_, value any) bool {
+		subscriptions = append(subscriptions, value.(*eventSubscription))
+		return true
+	})
+	c.subscriptionMutex.Unlock()
+
+	c.subscribeStates(true)
+	for _, s := range subscriptions {
+		if err := c.subscribe(s); err != nil {
+			log.Error().Err(err).Str("event", s.eventType).Msg("Could not subscribe to HomeAssistant events")
+		}
+	}
+}
+
+func (c *Connection) handleEvent(id uint64, msg []byte) {
+	if id == c.stateSubscription.Load() {
+		c.handleEntities(msg, id == c.restoredStates.Load())
+		return
+	}
+
+	var event msgs.EventResponse
+	if err := json.Unmarshal(msg, &event); err != nil {
+		log.Error().RawJSON("msg", msg).Err(err).Msg("Could not parse EventResponse")
+		return
+	}
+
+	var handler EventHandler
+	c.subscriptions.Range(func(_, value any) bool {
+		if s := value.(*eventSubscription); s.remoteId.Load() == id {
+			handler = s.handler
+			return false
+		}
+		return true
+	})
+	if handler == nil {
+		log.Debug().Uint64("id", id).Msg("Received event but did not find a subscription")
+		return
+	}
+	handler(event)
+}
+
+// handleEntities applies the compressed states of subscribe_entities to the known entity states and dispatches
+// the changes by entity id. Initial states of unknown entities are not dispatched, the connector reconciles them.
+// Changed initial states of a subscription restored after a reconnect are dispatched as missed.
+func (c *Connection) handleEntities(msg []byte, restored bool) {
+	var event msgs.EntitiesResponse
+	if err := json.Unmarshal(msg, &event); err != nil {
+		log.Error().RawJSON("msg", msg).Err(err).Msg("Could not parse subscribe_entities event")
+		return
+	}
+
+	type change struct {
+		state  msgs.SensorState
+		missed bool
+	}
+	var changed []change
+	c.entityMutex.Lock()
+	if c.entityStates == nil {
+		c.entityStates = map[string]msgs.CompressedState{}
+	}
+	for entityId, state := range event.Event.Added {
+		old, known := c.entityStates[entityId]
+		c.entityStates[entityId] = state
+		// a change between two subscriptions or while the connection was lost only shows in the initial states of
+		// the new subscription
+		if known && old.State != state.State {
+			changed = append(changed, change{state: state.SensorState(entityId), missed: restored})
+		}
+	}
+	for entityId, diff := range event.Event.Changed {
+		state := c.entityStates[entityId].Apply(diff)
+		c.entityStates[entityId] = state
+		changed = append(changed, change{state: state.SensorState(entityId)})
+	}
+	for _, entityId := range event.Event.Removed {
+		delete(c.entityStates, entityId)
+	}
+	c.entityMutex.Unlock()
+
+	for _, ch := range changed {
+		if h, ok := c.stateHandlers.Load(ch.state.EntityID); ok {
+			h.(StateEventHandler)(ch.state.EntityID, ch.state, ch.missed)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package connection
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
+)
+
+func TestHandleEntities(t *testing.T) {
+	const initial = `{"id":1,"type":"event","event":{"a":{"binary_sensor.door":{"s":"off","a":{"device_class":"door"}}}}}`
+	const opened = `{"id":2,"type":"event","event":{"a":{"binary_sensor.door":{"s":"on","a":{"device_class":"door"}}}}}`
+
+	tests := []struct {
+		name      string
+		events    []string
+		reconnect int // index of the event that is the first one after a reconnect, 0 for none
+		want      []string
+		wantAttrs map[string]any
+	}{
+		{
+			name:   "initial states are not dispatched",
+			events: []string{initial},
+		},
+		{
+			name:      "state change",
+			events:    []string{initial, `{"id":1,"type":"event","event":{"c":{"binary_sensor.door":{"+":{"s":"on"}}}}}`},
+			want:      []string{"on"},
+			wantAttrs: map[string]any{"device_class": "door"},
+		},
+		{
+			name: "attribute change keeps the state",
+			events: []string{initial,
+				`{"id":1,"type":"event","event":{"c":{"binary_sensor.door":{"+":{"a":{"friendly_name":"Door"}},"-":{"a":["device_class"]}}}}}`},
+			want:      []string{"off"},
+			wantAttrs: map[string]any{"friendly_name": "Door"},
+		},
+		{
+			name:      "changed initial state of a new subscription",
+			events:    []string{initial, opened},
+			want:      []string{"on"},
+			wantAttrs: map[string]any{"device_class": "door"},
+		},
+		{
+			name:   "unchanged initial state of a new subscription",
+			events: []string{initial, initial},
+		},
+		{
+			name:      "state changed while the connection was lost",
+			events:    []string{initial, opened},
+			reconnect: 1,
+			want:      []string{"on (missed)"},
+			wantAttrs: map[string]any{"device_class": "door"},
+		},
+		{
+			name:      "unchanged state after a reconnect",
+			events:    []string{initial, initial},
+			reconnect: 1,
+		},
+		{
+			name: "live change after a reconnect",
+			events: []string{initial, initial,
+				`{"id":2,"type":"event","event":{"c":{"binary_sensor.door":{"+":{"s":"on"}}}}}`},
+			reconnect: 1,
+			want:      []string{"on"},
+			wantAttrs: map[string]any{"device_class": "door"},
+		},
+		{
+			name: "removed entity is unknown again",
+			events: []string{initial,
+				`{"id":1,"type":"event","event":{"r":["binary_sensor.door"]}}`,
+				`{"id":1,"type":"event","event":{"a":{"binary_sensor.door":{"s":"on"}}}}`},
+		},
+		{
+			name:   "entity without handler",
+			events: []string{`{"id":1,"type":"event","event":{"c":{"light.kitchen":{"+":{"s":"on"}}}}}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnection("", "")
+			var got []string
+			var gotAttrs map[string]any
+			c.stateHandlers.Store("binary_sensor.door", StateEventHandler(func(entityId string, state msgs.SensorState, missed bool) {
+				if missed {
+					got = append(got, state.State+" (missed)")
+				} else {
+					got = append(got, state.State)
+				}
+				gotAttrs = map[string]any{}
+				if state.Attributes.DeviceClass != "" {
+					gotAttrs["device_class"] = state.Attributes.DeviceClass
+				}
+				if state.Attributes.FriendlyName != "" {
+					gotAttrs["friendly_name"] = state.Attributes.FriendlyName
+				}
+			}))
+			for i, e := range tt.events {
+				if tt.reconnect > 0 && i == tt.reconnect {
+					c.resetSubscriptions()
+				}
+				c.handleEntities([]byte(e), tt.reconnect > 0 && i == tt.reconnect)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("states = %v, want %v", got, tt.want)
+			}
+			if tt.wantAttrs != nil && !reflect.DeepEqual(gotAttrs, tt.wantAttrs) {
+				t.Errorf("attributes = %v, want %v", gotAttrs, tt.wantAttrs)
+			}
+		})
+	}
+}
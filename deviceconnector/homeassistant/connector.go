@@ -2,24 +2,44 @@ package homeassistant
 
 import (
 	"errors"
+	"fmt"
 	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/connection"
 	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
 	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
 	"github.com/mtrossbach/waechter/system"
 	"github.com/mtrossbach/waechter/system/device"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Connector struct {
-	conf             config.HomeAssistantConfig
-	ctrl             system.Controller
-	conn             *connection.Connection
-	availableDevices sync.Map //map[device.Id]assembledDevice
-	activeDevices    sync.Map //map[device.Id]nil
-	connected        bool
+	conf                config.HomeAssistantConfig
+	ctrl                system.Controller
+	conn                *connection.Connection
+	availableDevices    sync.Map //map[device.Id]assembledDevice
+	activeDevices       sync.Map //map[device.Id]assembledDevice
+	keypadSubscriptions sync.Map //map[device.Id]uint64
+	states              sync.Map //map[string]msgs.SensorState
+	connected           bool
+
+	refreshMutex sync.Mutex
+	refreshTimer *time.Timer
+
+	actorQueue chan actorRequest
+}
+
+// actorQueueSize is the number of actor requests waiting for their service calls before new ones are refused.
+const actorQueueSize = 100
+
+type actorRequest struct {
+	id    device.Id
+	actor device.Actor
+	calls []serviceCall
 }
 
 func NewConnector(configuration config.HomeAssistantConfig) (*Connector, error) {
@@ -41,6 +61,7 @@ func NewConnector(configuration config.HomeAssistantConfig) (*Connector, error)
 		availableDevices: sync.Map{},
 		activeDevices:    sync.Map{},
 		connected:        false,
+		actorQueue:       make(chan actorRequest, actorQueueSize),
 	}, nil
 }
 
@@ -61,6 +82,9 @@ func (c *Connector) Setup(controller system.Controller) {
 		c.connected = false
 		c.ctrl.OperationalStateChanged(c)
 	}
+	// subscriptions are kept by the connection and restored after every reconnect
+	c.subscribeRegistryEvents()
+	go c.callServices()
 	c.conn.Connect()
 }
 
@@ -71,38 +95,87 @@ func (c *Connector) updateDeviceList() {
 		return
 	}
 
+	reg, err := c.getRegistries()
+	if err != nil {
+		// listing the registries needs an admin token, without them every entity is a device of its own
+		log.Error().Err(err).Msg("Could not request registries from HomeAssistant")
+	}
+
+	// devices are keyed by their registry id, entities without device by their entity id
 	devs := make(map[string]assembledDevice)
 
 	for _, s := range st.Result {
-		prefix := entityPrefix(s.EntityID)
-		dev, ok := devs[prefix]
+		c.states.Store(s.EntityID, s)
+		if reg.disabled(s.EntityID) {
+			continue
+		}
+
+		conf, configured := c.actorConfig(s.EntityID)
+		if actors := actorsForDomain(domain(s.EntityID), configured); len(actors) > 0 {
+			dev := c.actorDevice(s.EntityID, s.Attributes.FriendlyName, conf, actors)
+			dev.spec.Area = reg.area(s.EntityID)
+			devs[s.EntityID] = dev
+			continue
+		}
+
+		sensor := sensorForState(s)
+		if len(sensor) == 0 {
+			continue
+		}
+
+		key := s.EntityID
+		hd := reg.device(s.EntityID)
+		if hd != nil {
+			key = hd.Id
+		}
+		dev, ok := devs[key]
 		if !ok {
 			dev = assembledDevice{
-				entityId:    prefix,
+				entityId:    s.EntityID,
 				displayName: s.Attributes.FriendlyName,
 				sensors:     map[device.Sensor]string{},
+				area:        reg.area(s.EntityID),
+			}
+			if hd != nil {
+				if dev.entityId = slug(deviceName(*hd)); len(dev.entityId) == 0 {
+					dev.entityId = hd.Id
+				}
+				dev.displayName = deviceName(*hd)
+				dev.vendor = hd.Manufacturer
+				dev.model = hd.Model
+				dev.ieeeAddress = ieeeAddress(*hd)
+				dev.area = reg.areas[hd.AreaId]
 			}
 		}
+		dev.sensors[sensor] = s.EntityID
+		devs[key] = dev
+	}
 
-		switch s.Attributes.DeviceClass {
-		case "motion":
-			dev.sensors[device.MotionSensor] = s.EntityID
-		case "opening", "door", "window", "garage_door":
-			dev.sensors[device.ContactSensor] = s.EntityID
-		case "smoke":
-			dev.sensors[device.SmokeSensor] = s.EntityID
-		case "battery":
-			if strings.HasPrefix(s.EntityID, "binary_sensor") {
-				dev.sensors[device.BatteryWarningSensor] = s.EntityID
-			} else {
-				dev.sensors[device.BatteryLevelSensor] = s.EntityID
-			}
-		case "tamper":
-			dev.sensors[device.TamperSensor] = s.EntityID
+	// devices with the same name get the start of their registry id appended. Registry ids never change, but the
+	// suffix is only added while the name is taken twice, so a device gets a new id once a namesake appears.
+	names := map[string]int{}
+	for _, dev := range devs {
+		names[dev.entityId]++
+	}
+	for key, dev := range devs {
+		if names[dev.entityId] > 1 && key != dev.entityId {
+			dev.entityId = fmt.Sprintf("%s_%.6s", dev.entityId, key)
+		}
+		if dev.spec.Id == "" {
+			dev.spec = dev.generateSpec(c.Id())
 		}
+		devs[key] = dev
+	}
 
-		dev.spec = dev.generateSpec(c.Id())
-		devs[prefix] = dev
+	for _, conf := range c.conf.Keypads {
+		dev := c.keypadDevice(conf)
+		devs[dev.entityId] = dev
+	}
+
+	for _, conf := range c.conf.Actors {
+		if domain(conf.Service) == "notify" {
+			devs[conf.Service] = c.actorDevice(conf.Service, conf.Service, conf, actorsForDomain("notify", true))
+		}
 	}
 
 	c.availableDevices = sync.Map{}
@@ -112,9 +185,10 @@ func (c *Connector) updateDeviceList() {
 		}
 	}
 
-	c.activeDevices.Range(func(key, _ any) bool {
-		_, found := c.availableDevices.Load(key)
-		if !found {
+	c.activeDevices.Range(func(key, value any) bool {
+		if d, found := c.availableDevices.Load(key); found {
+			c.updateActiveDevice(key.(device.Id), value.(assembledDevice), d.(assembledDevice))
+		} else {
 			_ = c.DeactivateDevice(key.(device.Id))
 		}
 		return true
@@ -123,6 +197,43 @@ func (c *Connector) updateDeviceList() {
 	c.ctrl.DeviceListUpdated(c)
 }
 
+func (c *Connector) actorDevice(target string, displayName string, conf config.HomeAssistantActorConfig, actors []device.Actor) assembledDevice {
+	if len(conf.Name) > 0 {
+		displayName = conf.Name
+	}
+	dev := assembledDevice{
+		entityId:    target,
+		displayName: displayName,
+		sensors:     map[device.Sensor]string{},
+		actors:      actors,
+		target:      target,
+	}
+	dev.spec = dev.generateSpec(c.Id())
+	return dev
+}
+
+// sensorForState returns the sensor an entity provides, or an empty sensor if it is not relevant.
+func sensorForState(s msgs.SensorState) device.Sensor {
+	switch s.Attributes.DeviceClass {
+	case "motion":
+		return device.MotionSensor
+	case "opening", "door", "window", "garage_door":
+		return device.ContactSensor
+	case "smoke":
+		return device.SmokeSensor
+	case "vibration":
+		return device.VibrationSensor
+	case "battery":
+		if strings.HasPrefix(s.EntityID, "binary_sensor") {
+			return device.BatteryWarningSensor
+		}
+		return device.BatteryLevelSensor
+	case "tamper":
+		return device.TamperSensor
+	}
+	return ""
+}
+
 func (c *Connector) getStates() (msgs.StateResult, error) {
 	var result msgs.StateResult
 	err := c.conn.Command(&msgs.BaseMessage{Type: msgs.GetStates}, &result)
@@ -167,72 +278,161 @@ func (c *Connector) ActivateDevice(id device.Id) error {
 		return errors.New("device not found")
 	}
 
-	if d, ok := dev.(assembledDevice); ok {
-		for sensor, entityId := range d.sensors {
-			if err := c.conn.SubscribeStateEvents(entityId, c.deviceEventHandler(id, sensor)); err != nil {
-				log.Error().Err(err).Str("device", string(id)).Str("entityId", entityId).Msg("Could not setup state trigger for device")
-			}
-		}
+	d := dev.(assembledDevice)
+	if d.keypad != nil {
+		c.activateKeypad(id, *d.keypad)
 	}
+	c.subscribeSensors(id, d)
+	c.activeDevices.Store(id, d)
+	c.reconcile(id, d)
 
 	return nil
 }
 
 func (c *Connector) DeactivateDevice(id device.Id) error {
-	_, found := c.activeDevices.Load(id)
-	if found {
+	dev, found := c.activeDevices.LoadAndDelete(id)
+	if !found {
 		return errors.New("device not found")
 	}
 
-	dev, found := c.availableDevices.Load(id)
-	if !found {
-		return errors.New("device not found")
+	d := dev.(assembledDevice)
+	if d.keypad != nil {
+		c.deactivateKeypad(id, *d.keypad)
+	}
+	for _, entityId := range d.sensors {
+		c.conn.UnsubscribeStateEvents(entityId)
 	}
 
-	if d, ok := dev.(assembledDevice); ok {
-		for _, entityId := range d.sensors {
-			if err := c.conn.UnsubscribeStateEvents(entityId); err != nil {
-				log.Error().Err(err).Str("device", string(id)).Str("entityId", entityId).Msg("Could not uninstall state trigger for device")
-			}
+	return nil
+}
+
+// updateActiveDevice takes over changed entities of an active device after a device list update.
+func (c *Connector) updateActiveDevice(id device.Id, old assembledDevice, d assembledDevice) {
+	for sensor, entityId := range old.sensors {
+		if d.sensors[sensor] != entityId {
+			c.conn.UnsubscribeStateEvents(entityId)
 		}
 	}
+	c.subscribeSensors(id, d)
+	c.activeDevices.Store(id, d)
+	c.reconcile(id, d)
+}
 
-	return nil
+func (c *Connector) subscribeSensors(id device.Id, d assembledDevice) {
+	for sensor, entityId := range d.sensors {
+		c.conn.SubscribeStateEvents(entityId, c.deviceEventHandler(id, sensor))
+	}
 }
 
 func (c *Connector) DisconnectForReconnect() {
 }
 
 func (c *Connector) ControlActor(id device.Id, actor device.Actor, value any) bool {
-	//Not yet supported
+	dev, ok := c.availableDevices.Load(id)
+	if !ok || !wslice.Contains(dev.(assembledDevice).actors, actor) {
+		return false
+	}
+
+	var calls []serviceCall
+	if k := dev.(assembledDevice).keypad; k != nil {
+		calls = c.panelServiceCalls(*k)
+	} else {
+		calls = c.serviceCalls(dev.(assembledDevice).target, actor)
+	}
+	if len(calls) == 0 {
+		return true
+	}
+	// service calls wait for the answer of HomeAssistant, so they must not block the caller
+	select {
+	case c.actorQueue <- actorRequest{id: id, actor: actor, calls: calls}:
+	default:
+		log.Error().Str("device", string(id)).Str("actor", string(actor)).Msg("Actor queue full, dropping service calls")
+		go c.ctrl.ActorControlled(id, actor, errors.New("actor queue full"))
+	}
 	return true
 }
 
+// callServices runs the service calls of the actor requests one after the other, so that e.g. turning a siren off
+// cannot overtake turning it on. The result is reported per request.
+func (c *Connector) callServices() {
+	for r := range c.actorQueue {
+		var err error
+		for _, call := range r.calls {
+			log.Debug().Str("device", string(r.id)).Str("domain", call.domain).Str("service", call.service).Interface("data", call.data).Msg("Calling HomeAssistant service")
+			if e := c.conn.CallService(call.domain, call.service, call.data, call.entityId); e != nil {
+				err = e
+			}
+		}
+		c.ctrl.ActorControlled(r.id, r.actor, err)
+	}
+}
+
+// reconcile delivers the states fetched with the last device list update, so that changes that happened while
+// Waechter or the connection was offline are evaluated.
+func (c *Connector) reconcile(id device.Id, d assembledDevice) {
+	for sensor, entityId := range d.sensors {
+		st, ok := c.states.Load(entityId)
+		if !ok {
+			continue
+		}
+		if value := c.sensorValue(sensor, st.(msgs.SensorState).State); value != nil {
+			c.ctrl.ReconcileSensorValue(id, sensor, value)
+		}
+	}
+}
+
 func (c *Connector) deviceEventHandler(id device.Id, sensor device.Sensor) connection.StateEventHandler {
-	return func(entityId string, event msgs.EventResponse) {
-		switch sensor {
-		case device.MotionSensor:
-			c.ctrl.DeliverSensorValue(id, sensor, device.MotionSensorValue{Motion: event.Event.Variables.Trigger.ToState.State == "on"})
-
-		case device.ContactSensor:
-			c.ctrl.DeliverSensorValue(id, sensor, device.ContactSensorValue{Contact: event.Event.Variables.Trigger.ToState.State == "on"})
-
-		case device.SmokeSensor:
-			c.ctrl.DeliverSensorValue(id, sensor, device.SmokeSensorValue{Smoke: event.Event.Variables.Trigger.ToState.State == "on"})
-
-		case device.BatteryLevelSensor:
-			level, err := strconv.Atoi(event.Event.Variables.Trigger.ToState.State)
-			if err != nil {
-				log.Error().Err(err).Str("state", event.Event.Variables.Trigger.ToState.State).Msg("Could not parse battery level")
-			} else {
-				c.ctrl.DeliverSensorValue(id, sensor, device.BatteryLevelSensorValue{BatteryLevel: float32(level) / 100.0})
+	return func(entityId string, state msgs.SensorState, missed bool) {
+		c.states.Store(entityId, state)
+		value := c.sensorValue(sensor, state.State)
+		if missed {
+			// like the states fetched after a reconnect, it is unknown when the change happened
+			if value != nil {
+				c.ctrl.ReconcileSensorValue(id, sensor, value)
 			}
+			return
+		}
 
-		case device.BatteryWarningSensor:
-			c.ctrl.DeliverSensorValue(id, sensor, device.BatteryWarningSensorValue{BatteryWarning: event.Event.Variables.Trigger.ToState.State == "on"})
-		case device.TamperSensor:
-			c.ctrl.DeliverSensorValue(id, sensor, device.TamperSensorValues{Tamper: event.Event.Variables.Trigger.ToState.State == "on"})
+		c.ctrl.DeviceSeen(id)
+		if value != nil {
+			c.ctrl.DeliverSensorValue(id, sensor, value)
+		}
+	}
+}
 
+func (c *Connector) sensorValue(sensor device.Sensor, state string) any {
+	if state == "unavailable" || state == "unknown" {
+		return nil
+	}
+
+	switch sensor {
+	case device.MotionSensor:
+		return device.MotionSensorValue{Motion: state == "on"}
+
+	case device.ContactSensor:
+		// binary sensors of the opening classes are "on" while open, contact means closed
+		return device.ContactSensorValue{Contact: state == "off"}
+
+	case device.SmokeSensor:
+		return device.SmokeSensorValue{Smoke: state == "on"}
+
+	case device.VibrationSensor:
+		return device.VibrationSensorValue{Vibration: state == "on"}
+
+	case device.BatteryLevelSensor:
+		// many integrations report the level as float, e.g. "87.0"
+		level, err := strconv.ParseFloat(state, 64)
+		if err != nil {
+			log.Error().Err(err).Str("state", state).Msg("Could not parse battery level")
+			return nil
 		}
+		return device.BatteryLevelSensorValue{BatteryLevel: float32(math.Round(level))}
+
+	case device.BatteryWarningSensor:
+		return device.BatteryWarningSensorValue{BatteryWarning: state == "on"}
+
+	case device.TamperSensor:
+		return device.TamperSensorValues{Tamper: state == "on"}
 	}
+	return nil
 }
@@ -0,0 +1,102 @@
+package homeassistant
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+func TestSensorValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		sensor device.Sensor
+		state  string
+		want   any
+	}{
+		{name: "motion detected", sensor: device.MotionSensor, state: "on", want: device.MotionSensorValue{Motion: true}},
+		{name: "no motion", sensor: device.MotionSensor, state: "off", want: device.MotionSensorValue{Motion: false}},
+		{name: "door open", sensor: device.ContactSensor, state: "on", want: device.ContactSensorValue{Contact: false}},
+		{name: "door closed", sensor: device.ContactSensor, state: "off", want: device.ContactSensorValue{Contact: true}},
+		{name: "smoke", sensor: device.SmokeSensor, state: "on", want: device.SmokeSensorValue{Smoke: true}},
+		{name: "vibration", sensor: device.VibrationSensor, state: "on", want: device.VibrationSensorValue{Vibration: true}},
+		{name: "battery level", sensor: device.BatteryLevelSensor, state: "42", want: device.BatteryLevelSensorValue{BatteryLevel: 42}},
+		{name: "float battery level", sensor: device.BatteryLevelSensor, state: "87.0", want: device.BatteryLevelSensorValue{BatteryLevel: 87}},
+		{name: "rounded battery level", sensor: device.BatteryLevelSensor, state: "9.6", want: device.BatteryLevelSensorValue{BatteryLevel: 10}},
+		{name: "invalid battery level", sensor: device.BatteryLevelSensor, state: "low", want: nil},
+		{name: "battery warning", sensor: device.BatteryWarningSensor, state: "on", want: device.BatteryWarningSensorValue{BatteryWarning: true}},
+		{name: "tamper", sensor: device.TamperSensor, state: "on", want: device.TamperSensorValues{Tamper: true}},
+		{name: "unavailable", sensor: device.ContactSensor, state: "unavailable", want: nil},
+		{name: "unknown", sensor: device.MotionSensor, state: "unknown", want: nil},
+		{name: "unsupported sensor", sensor: device.LinkQualitySensor, state: "on", want: nil},
+	}
+
+	c := &Connector{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.sensorValue(tt.sensor, tt.state); got != tt.want {
+				t.Errorf("sensorValue(%s, %q) = %v, want %v", tt.sensor, tt.state, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorForState(t *testing.T) {
+	tests := []struct {
+		name        string
+		entityId    string
+		deviceClass string
+		want        device.Sensor
+	}{
+		{name: "motion", entityId: "binary_sensor.hall_motion", deviceClass: "motion", want: device.MotionSensor},
+		{name: "opening", entityId: "binary_sensor.hall_opening", deviceClass: "opening", want: device.ContactSensor},
+		{name: "door", entityId: "binary_sensor.front_door", deviceClass: "door", want: device.ContactSensor},
+		{name: "window", entityId: "binary_sensor.kitchen_window", deviceClass: "window", want: device.ContactSensor},
+		{name: "garage door", entityId: "binary_sensor.garage", deviceClass: "garage_door", want: device.ContactSensor},
+		{name: "smoke", entityId: "binary_sensor.smoke", deviceClass: "smoke", want: device.SmokeSensor},
+		{name: "vibration", entityId: "binary_sensor.safe", deviceClass: "vibration", want: device.VibrationSensor},
+		{name: "battery warning", entityId: "binary_sensor.hall_battery", deviceClass: "battery", want: device.BatteryWarningSensor},
+		{name: "battery level", entityId: "sensor.hall_battery", deviceClass: "battery", want: device.BatteryLevelSensor},
+		{name: "tamper", entityId: "binary_sensor.hall_tamper", deviceClass: "tamper", want: device.TamperSensor},
+		{name: "irrelevant class", entityId: "sensor.hall_temperature", deviceClass: "temperature", want: ""},
+		{name: "no class", entityId: "binary_sensor.hall", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := msgs.SensorState{EntityID: tt.entityId, Attributes: msgs.Attributes{DeviceClass: tt.deviceClass}}
+			if got := sensorForState(s); got != tt.want {
+				t.Errorf("sensorForState(%s, %s) = %q, want %q", tt.entityId, tt.deviceClass, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSpecFormerIds(t *testing.T) {
+	tests := []struct {
+		name     string
+		entityId string
+		sensors  map[device.Sensor]string
+		want     []device.Id
+	}{
+		{name: "entity without device", entityId: "binary_sensor.hall_motion",
+			sensors: map[device.Sensor]string{device.MotionSensor: "binary_sensor.hall_motion"}},
+		{name: "grouped entities", entityId: "hall_motion_sensor",
+			sensors: map[device.Sensor]string{
+				device.TamperSensor: "binary_sensor.hall_tamper",
+				device.MotionSensor: "binary_sensor.hall_motion",
+			},
+			want: []device.Id{"ha::binary_sensor.hall_motion", "ha::binary_sensor.hall_tamper"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assembledDevice{entityId: tt.entityId, sensors: tt.sensors}
+			spec := a.generateSpec("ha")
+			if !reflect.DeepEqual(spec.FormerIds, tt.want) {
+				t.Errorf("FormerIds = %v, want %v", spec.FormerIds, tt.want)
+			}
+		})
+	}
+}
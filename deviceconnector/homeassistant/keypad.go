@@ -0,0 +1,220 @@
+package homeassistant
+
+import (
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/connection"
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/device"
+	"strings"
+)
+
+type keypadCommand string
+
+const (
+	armAllCommand       keypadCommand = "arm_all"
+	armPerimeterCommand keypadCommand = "arm_perimeter"
+	disarmCommand       keypadCommand = "disarm"
+	panicCommand        keypadCommand = "panic"
+	fireCommand         keypadCommand = "fire"
+	ignoreCommand       keypadCommand = "ignore"
+)
+
+const (
+	keypadPrefix     = "keypad."
+	defaultCodeField = "args.code"
+)
+
+// defaultActionFields and defaultKeypadActions match the zha_event of ZHA IAS ACE keypads.
+var defaultActionFields = []string{"args.arm_mode_description", "command"}
+
+var defaultKeypadActions = map[string]keypadCommand{
+	"Disarm":               disarmCommand,
+	"Arm_All_Zones":        armAllCommand,
+	"Arm_Day_Home_Only":    armPerimeterCommand,
+	"Arm_Night_Sleep_Only": armPerimeterCommand,
+	"emergency":            panicCommand,
+	"panic":                panicCommand,
+	"fire":                 fireCommand,
+}
+
+// panelStateActions maps the states of alarm panel entities. Disarming needs a code, which state changes do
+// not carry, so panel entities can only arm.
+var panelStateActions = map[string]keypadCommand{
+	"armed_away":  armAllCommand,
+	"armed_home":  armPerimeterCommand,
+	"armed_night": armPerimeterCommand,
+}
+
+func (c *Connector) keypadDevice(conf config.HomeAssistantKeypadConfig) assembledDevice {
+	dev := assembledDevice{
+		entityId:    keypadPrefix + conf.Name,
+		displayName: conf.Name,
+		sensors:     map[device.Sensor]string{},
+		keypad:      &conf,
+	}
+	if len(conf.Entities) > 0 {
+		dev.actors = []device.Actor{device.StateActor}
+	}
+	dev.spec = dev.generateSpec(c.Id())
+	dev.spec.Sensors = append(dev.spec.Sensors, device.ArmingSensor, device.DisarmingSensor, device.PanicSensor, device.FireSensor)
+	return dev
+}
+
+func (c *Connector) activateKeypad(id device.Id, conf config.HomeAssistantKeypadConfig) {
+	if len(conf.Event) > 0 {
+		subscription, err := c.conn.SubscribeEvents(conf.Event, c.keypadEventHandler(id, conf))
+		if err != nil {
+			log.Error().Err(err).Str("device", string(id)).Str("event", conf.Event).Msg("Could not subscribe to keypad events")
+		} else {
+			c.keypadSubscriptions.Store(id, subscription)
+		}
+	}
+	for _, entityId := range conf.Entities {
+		c.conn.SubscribeStateEvents(entityId, c.panelStateHandler(id, conf))
+	}
+}
+
+func (c *Connector) deactivateKeypad(id device.Id, conf config.HomeAssistantKeypadConfig) {
+	if subscription, ok := c.keypadSubscriptions.LoadAndDelete(id); ok {
+		if err := c.conn.UnsubscribeEvents(subscription.(uint64)); err != nil {
+			log.Error().Err(err).Str("device", string(id)).Str("event", conf.Event).Msg("Could not unsubscribe from keypad events")
+		}
+	}
+	for _, entityId := range conf.Entities {
+		c.conn.UnsubscribeStateEvents(entityId)
+	}
+}
+
+func (c *Connector) keypadEventHandler(id device.Id, conf config.HomeAssistantKeypadConfig) connection.EventHandler {
+	fields := conf.ActionFields
+	if len(fields) == 0 {
+		fields = defaultActionFields
+	}
+	codeField := conf.CodeField
+	if len(codeField) == 0 {
+		codeField = defaultCodeField
+	}
+
+	return func(event msgs.EventResponse) {
+		var action string
+		for _, f := range fields {
+			if v, ok := eventField(event.Event.Data, f).(string); ok && len(v) > 0 {
+				action = v
+				break
+			}
+		}
+		if len(action) == 0 {
+			return
+		}
+		code, _ := eventField(event.Event.Data, codeField).(string)
+
+		command, ok := keypadCommand(conf.Actions[action]), len(conf.Actions[action]) > 0
+		if !ok {
+			command, ok = defaultKeypadActions[action]
+		}
+		if !ok || command == ignoreCommand {
+			log.Debug().Str("device", string(id)).Str("action", action).Msg("Ignoring keypad action")
+			return
+		}
+
+		c.ctrl.DeviceSeen(id)
+		c.deliverKeypadCommand(id, command, code, conf.RequirePin)
+	}
+}
+
+func (c *Connector) panelStateHandler(id device.Id, conf config.HomeAssistantKeypadConfig) connection.StateEventHandler {
+	return func(entityId string, st msgs.SensorState, missed bool) {
+		if missed {
+			// commands given while the connection was lost are not executed late, the panel is set back instead
+			c.ControlActor(id, device.StateActor, nil)
+			return
+		}
+		state := st.State
+		command, ok := panelStateActions[state]
+		if !ok {
+			if state == "disarmed" && c.ctrl.SystemState().Armed() {
+				log.Warn().Str("device", string(id)).Str("entityId", entityId).Msg("Alarm panels can not disarm without code")
+				c.ControlActor(id, device.StateActor, nil)
+			}
+			return
+		}
+
+		c.ctrl.DeviceSeen(id)
+		// state changes of alarm panels carry no code, so they are refused if the keypad requires a PIN
+		c.deliverKeypadCommand(id, command, "", conf.RequirePin)
+	}
+}
+
+// deliverKeypadCommand delivers the command and pushes the system state back to the keypad if it was refused, so
+// that the keypad does not show a state the system is not in. Arming without code is refused if a PIN is required.
+func (c *Connector) deliverKeypadCommand(id device.Id, command keypadCommand, code string, requirePin bool) {
+	accepted := true
+	switch command {
+	case armAllCommand, armPerimeterCommand:
+		mode := arm.All
+		if command == armPerimeterCommand {
+			mode = arm.Perimeter
+		}
+		if c.ctrl.SystemState().ArmMode == mode {
+			return
+		}
+		if requirePin && len(code) == 0 {
+			log.Warn().Str("device", string(id)).Str("command", string(command)).Msg("Keypad requires a PIN, command without code")
+			accepted = false
+			break
+		}
+		accepted = c.ctrl.DeliverSensorValue(id, device.ArmingSensor, device.ArmingSensorValue{ArmMode: mode, Pin: code, PinRequired: requirePin})
+	case disarmCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.DisarmingSensor, device.DisarmingSensorValue{Pin: code})
+	case panicCommand:
+		c.ctrl.DeliverSensorValue(id, device.PanicSensor, device.PanicSensorValue{Panic: true})
+		c.ctrl.DeliverSensorValue(id, device.PanicSensor, device.PanicSensorValue{Panic: false})
+	case fireCommand:
+		c.ctrl.DeliverSensorValue(id, device.FireSensor, device.FireSensorValue{Fire: true})
+	}
+
+	if !accepted {
+		log.Info().Str("device", string(id)).Str("command", string(command)).Msg("Keypad command refused")
+		c.ControlActor(id, device.StateActor, nil)
+	}
+}
+
+// panelServiceCalls pushes the system state to the alarm panel entities of a keypad.
+func (c *Connector) panelServiceCalls(conf config.HomeAssistantKeypadConfig) []serviceCall {
+	state := c.ctrl.SystemState()
+	service := "alarm_disarm"
+	if state.Alarm != alarm.None && !state.Alarm.IsPending() {
+		service = "alarm_trigger"
+	} else if state.ArmMode == arm.All {
+		service = "alarm_arm_away"
+	} else if state.ArmMode == arm.Perimeter {
+		service = "alarm_arm_home"
+	}
+
+	var data map[string]any
+	if len(conf.Code) > 0 {
+		data = map[string]any{"code": conf.Code}
+	}
+
+	var result []serviceCall
+	for _, entityId := range conf.Entities {
+		result = append(result, serviceCall{domain: "alarm_control_panel", service: service, data: data, entityId: entityId})
+	}
+	return result
+}
+
+// eventField returns a value of the event data, nested fields are separated by dots (e.g. "args.code").
+func eventField(data map[string]any, field string) any {
+	var value any = data
+	for _, key := range strings.Split(field, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
@@ -6,16 +6,21 @@ type EventResponse struct {
 }
 
 type EventContainer struct {
-	Variables VariablesContainer `json:"variables"`
+	EventType string         `json:"event_type"`
+	Data      map[string]any `json:"data"`
 }
 
-type VariablesContainer struct {
-	Trigger TriggerContainer `json:"trigger"`
+type StateChangedResponse struct {
+	BaseMessage
+	Event StateChangedEvent `json:"event"`
+}
+
+type StateChangedEvent struct {
+	Data StateChangedData `json:"data"`
 }
 
-type TriggerContainer struct {
-	Platform  string      `json:"platform"`
-	EntityID  string      `json:"entity_id"`
-	FromState SensorState `json:"from_state"`
-	ToState   SensorState `json:"to_state"`
+type StateChangedData struct {
+	EntityID string       `json:"entity_id"`
+	OldState *SensorState `json:"old_state"`
+	NewState *SensorState `json:"new_state"`
 }
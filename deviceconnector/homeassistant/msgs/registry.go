@@ -0,0 +1,40 @@
+package msgs
+
+type DeviceRegistryResult struct {
+	BaseResult
+	Result []DeviceRegistryEntry `json:"result"`
+}
+
+type DeviceRegistryEntry struct {
+	Id           string     `json:"id"`
+	Name         string     `json:"name"`
+	NameByUser   string     `json:"name_by_user"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+	AreaId       string     `json:"area_id"`
+	DisabledBy   *string    `json:"disabled_by"`
+	Identifiers  [][]string `json:"identifiers"`
+}
+
+type EntityRegistryResult struct {
+	BaseResult
+	Result []EntityRegistryEntry `json:"result"`
+}
+
+type EntityRegistryEntry struct {
+	EntityId   string  `json:"entity_id"`
+	DeviceId   string  `json:"device_id"`
+	AreaId     string  `json:"area_id"`
+	Platform   string  `json:"platform"`
+	DisabledBy *string `json:"disabled_by"`
+}
+
+type AreaRegistryResult struct {
+	BaseResult
+	Result []AreaRegistryEntry `json:"result"`
+}
+
+type AreaRegistryEntry struct {
+	AreaId string `json:"area_id"`
+	Name   string `json:"name"`
+}
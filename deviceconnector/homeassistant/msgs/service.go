@@ -0,0 +1,13 @@
+package msgs
+
+type CallServiceRequest struct {
+	BaseMessage
+	Domain      string         `json:"domain"`
+	Service     string         `json:"service"`
+	ServiceData map[string]any `json:"service_data,omitempty"`
+	Target      *ServiceTarget `json:"target,omitempty"`
+}
+
+type ServiceTarget struct {
+	EntityID string `json:"entity_id"`
+}
@@ -1,18 +1,75 @@
 package msgs
 
-type SubscribeStateRequest struct {
-	BaseMessage
-	Trigger TriggerDetails `json:"trigger"`
-}
+import "encoding/json"
 
-type TriggerDetails struct {
-	Platform string  `json:"platform"`
-	EntityID string  `json:"entity_id"`
-	From     *string `json:"from,omitempty"`
-	To       *string `json:"to,omitempty"`
+type SubscribeEventsRequest struct {
+	BaseMessage
+	EventType string `json:"event_type"`
 }
 
 type UnsubscribeRequest struct {
 	BaseMessage
 	Subscription uint64 `json:"subscription"`
 }
+
+type SubscribeEntitiesRequest struct {
+	BaseMessage
+	EntityIds []string `json:"entity_ids"`
+}
+
+// EntitiesResponse is an event of subscribe_entities with the full states of added entities, the changes of
+// known entities and the removed entities.
+type EntitiesResponse struct {
+	BaseMessage
+	Event EntitiesEvent `json:"event"`
+}
+
+type EntitiesEvent struct {
+	Added   map[string]CompressedState     `json:"a"`
+	Changed map[string]CompressedStateDiff `json:"c"`
+	Removed []string                       `json:"r"`
+}
+
+type CompressedState struct {
+	State      string                     `json:"s"`
+	Attributes map[string]json.RawMessage `json:"a"`
+}
+
+type CompressedStateDiff struct {
+	Additions *CompressedState    `json:"+"`
+	Removals  *CompressedRemovals `json:"-,"`
+}
+
+type CompressedRemovals struct {
+	Attributes []string `json:"a"`
+}
+
+// Apply returns the state with the changes of the diff, a diff without state only changes attributes.
+func (s CompressedState) Apply(d CompressedStateDiff) CompressedState {
+	result := CompressedState{State: s.State, Attributes: map[string]json.RawMessage{}}
+	for k, v := range s.Attributes {
+		result.Attributes[k] = v
+	}
+	if d.Additions != nil {
+		if len(d.Additions.State) > 0 {
+			result.State = d.Additions.State
+		}
+		for k, v := range d.Additions.Attributes {
+			result.Attributes[k] = v
+		}
+	}
+	if d.Removals != nil {
+		for _, k := range d.Removals.Attributes {
+			delete(result.Attributes, k)
+		}
+	}
+	return result
+}
+
+func (s CompressedState) SensorState(entityId string) SensorState {
+	result := SensorState{EntityID: entityId, State: s.State}
+	if data, err := json.Marshal(s.Attributes); err == nil {
+		_ = json.Unmarshal(data, &result.Attributes)
+	}
+	return result
+}
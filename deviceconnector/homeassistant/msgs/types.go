@@ -9,6 +9,7 @@ const (
 	AuthInvalid          MsgType = "auth_invalid"
 	Result               MsgType = "result"
 	SubscribeEvents      MsgType = "subscribe_events"
+	SubscribeEntities    MsgType = "subscribe_entities"
 	Event                MsgType = "event"
 	SubscribeTrigger     MsgType = "subscribe_trigger"
 	UnsubscribeEvents    MsgType = "unsubscribe_events"
@@ -22,4 +23,7 @@ const (
 	Ping                 MsgType = "ping"
 	Pong                 MsgType = "pong"
 	ValidateConfig       MsgType = "validate_config"
+	DeviceRegistryList   MsgType = "config/device_registry/list"
+	EntityRegistryList   MsgType = "config/entity_registry/list"
+	AreaRegistryList     MsgType = "config/area_registry/list"
 )
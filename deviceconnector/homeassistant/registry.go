@@ -0,0 +1,136 @@
+package homeassistant
+
+import (
+	"github.com/mtrossbach/waechter/deviceconnector/homeassistant/msgs"
+	"github.com/mtrossbach/waechter/internal/log"
+	"strings"
+	"time"
+)
+
+// registryEvents are fired by HomeAssistant when devices, entities or areas change, the device list is refreshed then.
+var registryEvents = []string{"device_registry_updated", "entity_registry_updated", "area_registry_updated"}
+
+// refreshDelay collects the registry events of e.g. a renamed device into one refresh.
+const refreshDelay = 5 * time.Second
+
+type registries struct {
+	devices  map[string]msgs.DeviceRegistryEntry
+	entities map[string]msgs.EntityRegistryEntry
+	areas    map[string]string
+}
+
+func (c *Connector) getRegistries() (registries, error) {
+	result := registries{
+		devices:  map[string]msgs.DeviceRegistryEntry{},
+		entities: map[string]msgs.EntityRegistryEntry{},
+		areas:    map[string]string{},
+	}
+
+	var devices msgs.DeviceRegistryResult
+	if err := c.conn.Command(&msgs.BaseMessage{Type: msgs.DeviceRegistryList}, &devices); err != nil {
+		return result, err
+	}
+	for _, d := range devices.Result {
+		result.devices[d.Id] = d
+	}
+
+	var entities msgs.EntityRegistryResult
+	if err := c.conn.Command(&msgs.BaseMessage{Type: msgs.EntityRegistryList}, &entities); err != nil {
+		return result, err
+	}
+	for _, e := range entities.Result {
+		result.entities[e.EntityId] = e
+	}
+
+	var areas msgs.AreaRegistryResult
+	if err := c.conn.Command(&msgs.BaseMessage{Type: msgs.AreaRegistryList}, &areas); err != nil {
+		return result, err
+	}
+	for _, a := range areas.Result {
+		result.areas[a.AreaId] = a.Name
+	}
+	return result, nil
+}
+
+func (c *Connector) subscribeRegistryEvents() {
+	for _, e := range registryEvents {
+		if _, err := c.conn.SubscribeEvents(e, func(event msgs.EventResponse) { c.scheduleRefresh() }); err != nil {
+			log.Error().Err(err).Str("event", e).Msg("Could not subscribe to HomeAssistant registry events")
+		}
+	}
+}
+
+func (c *Connector) scheduleRefresh() {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	if c.refreshTimer != nil {
+		c.refreshTimer.Stop()
+	}
+	c.refreshTimer = time.AfterFunc(refreshDelay, c.updateDeviceList)
+}
+
+// device returns the registry device of an entity, or nil for entities without device.
+func (r registries) device(entityId string) *msgs.DeviceRegistryEntry {
+	e, ok := r.entities[entityId]
+	if !ok || len(e.DeviceId) == 0 {
+		return nil
+	}
+	if d, ok := r.devices[e.DeviceId]; ok {
+		return &d
+	}
+	return nil
+}
+
+// disabled returns true if the entity or its device is disabled in HomeAssistant.
+func (r registries) disabled(entityId string) bool {
+	if e, ok := r.entities[entityId]; ok && e.DisabledBy != nil {
+		return true
+	}
+	if d := r.device(entityId); d != nil && d.DisabledBy != nil {
+		return true
+	}
+	return false
+}
+
+// area returns the name of the area of the entity, which defaults to the area of its device.
+func (r registries) area(entityId string) string {
+	areaId := r.entities[entityId].AreaId
+	if d := r.device(entityId); len(areaId) == 0 && d != nil {
+		areaId = d.AreaId
+	}
+	return r.areas[areaId]
+}
+
+func deviceName(d msgs.DeviceRegistryEntry) string {
+	if len(d.NameByUser) > 0 {
+		return d.NameByUser
+	}
+	return d.Name
+}
+
+// ieeeAddress returns the IEEE address of ZHA devices.
+func ieeeAddress(d msgs.DeviceRegistryEntry) string {
+	for _, i := range d.Identifiers {
+		if len(i) == 2 && i[0] == "zha" {
+			return i[1]
+		}
+	}
+	return ""
+}
+
+// slug turns a device name into an id the way HomeAssistant does for entity ids.
+func slug(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
@@ -1,34 +1,45 @@
 package homeassistant
 
 import (
+	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/system/device"
-	"strings"
+	"sort"
 )
 
 type assembledDevice struct {
 	sensors     map[device.Sensor]string
+	actors      []device.Actor
+	target      string // entity or notify service controlled by the actors
+	keypad      *config.HomeAssistantKeypadConfig
 	spec        device.Spec
 	entityId    string
 	displayName string
+	vendor      string
+	model       string
+	ieeeAddress string
+	area        string
 }
 
 func (a *assembledDevice) generateSpec(connectorId string) device.Spec {
 	spec := device.Spec{
 		Id:          device.NewId(connectorId, a.entityId),
 		DisplayName: a.displayName,
+		IeeeAddress: a.ieeeAddress,
+		Vendor:      a.vendor,
+		Model:       a.model,
+		Area:        a.area,
 		Sensors:     []device.Sensor{},
 		Actors:      []device.Actor{},
 	}
 
-	for s := range a.sensors {
+	for s, entityId := range a.sensors {
 		spec.Sensors = append(spec.Sensors, s)
+		// entities were devices of their own before they were grouped by the device registry
+		if id := device.NewId(connectorId, entityId); id != spec.Id {
+			spec.FormerIds = append(spec.FormerIds, id)
+		}
 	}
+	sort.Slice(spec.FormerIds, func(i, j int) bool { return spec.FormerIds[i] < spec.FormerIds[j] })
+	spec.Actors = append(spec.Actors, a.actors...)
 	return spec
 }
-
-func entityPrefix(entityId string) string {
-	if strings.Contains(entityId, "_") {
-		return entityId[:strings.LastIndex(entityId, "_")] + "_"
-	}
-	return entityId
-}
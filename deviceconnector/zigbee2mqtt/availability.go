@@ -0,0 +1,97 @@
+package zigbee2mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/device"
+	"strings"
+	"time"
+)
+
+type availabilityPayload struct {
+	State string `json:"state"`
+}
+
+func availabilityTopic(id device.Id) string {
+	return fmt.Sprintf("%v/availability", id.Entity())
+}
+
+// parseAvailability understands the legacy string payload as well as the JSON payload.
+func parseAvailability(payload []byte) (bool, error) {
+	state := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(state, "{") {
+		var p availabilityPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return false, err
+		}
+		state = p.State
+	}
+
+	switch state {
+	case "online":
+		return true, nil
+	case "offline":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown availability state %s", state)
+}
+
+// availabilityHandler reports a device unavailable once it stays offline for the grace period.
+func (c *Connector) availabilityHandler(id device.Id) MessageHandler {
+	return func(msg mqtt.Message) {
+		log.Debug().Str("id", string(id)).Str("topic", msg.Topic()).Str("payload", string(msg.Payload())).Msg("availabilityHandler")
+
+		online, err := parseAvailability(msg.Payload())
+		if err != nil {
+			log.Error().Err(err).Str("device", string(id)).Str("payload", string(msg.Payload())).Msg("Could not parse availability")
+			return
+		}
+
+		// messages may still arrive after the device was deactivated
+		if _, active := c.activeDevices.Load(id); !active {
+			return
+		}
+
+		c.offlineMutex.Lock()
+		t, offline := c.offline[id]
+		if online {
+			delete(c.offline, id)
+			c.offlineMutex.Unlock()
+			if !offline {
+				return
+			}
+			if t != nil {
+				t.Stop()
+				log.Info().Str("device", string(id)).Msg("Device back online within grace period")
+				return
+			}
+			log.Info().Str("device", string(id)).Msg("Device online again")
+			c.ctrl.DeviceAvailable(id)
+			return
+		}
+
+		if offline {
+			c.offlineMutex.Unlock()
+			return
+		}
+		grace := time.Duration(c.conf.AvailabilityGracePeriod) * time.Second
+		log.Info().Str("device", string(id)).Dur("gracePeriod", grace).Msg("Device offline")
+		var timer *time.Timer
+		timer = time.AfterFunc(grace, func() {
+			c.offlineMutex.Lock()
+			// the device came back online or was deactivated in the meantime
+			if current, ok := c.offline[id]; !ok || current != timer {
+				c.offlineMutex.Unlock()
+				return
+			}
+			c.offline[id] = nil
+			c.offlineMutex.Unlock()
+			log.Error().Str("device", string(id)).Msg("Device offline for longer than the grace period")
+			c.ctrl.DeviceUnavailable(id)
+		})
+		c.offline[id] = timer
+		c.offlineMutex.Unlock()
+	}
+}
@@ -0,0 +1,35 @@
+package zigbee2mqtt
+
+import "testing"
+
+func TestParseAvailability(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    bool
+		wantErr bool
+	}{
+		{name: "legacy online", payload: "online", want: true},
+		{name: "legacy offline", payload: "offline", want: false},
+		{name: "legacy with whitespace", payload: " online\n", want: true},
+		{name: "json online", payload: `{"state":"online"}`, want: true},
+		{name: "json offline", payload: `{"state":"offline"}`, want: false},
+		{name: "json unknown state", payload: `{"state":"unknown"}`, wantErr: true},
+		{name: "json without state", payload: `{}`, wantErr: true},
+		{name: "invalid json", payload: `{"state":`, wantErr: true},
+		{name: "unknown string", payload: "away", wantErr: true},
+		{name: "empty", payload: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAvailability([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAvailability() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseAvailability() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
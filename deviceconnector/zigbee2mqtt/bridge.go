@@ -0,0 +1,61 @@
+package zigbee2mqtt
+
+import (
+	"encoding/json"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtrossbach/waechter/internal/log"
+)
+
+// handleBridgeState tracks whether the Zigbee2Mqtt bridge itself is running. The state uses the same
+// formats as the device availability.
+func (c *Connector) handleBridgeState(msg mqtt.Message) {
+	log.Debug().Str("topic", msg.Topic()).Str("payload", string(msg.Payload())).Msg("handleBridgeState")
+
+	online, err := parseAvailability(msg.Payload())
+	if err != nil {
+		log.Error().Err(err).Str("payload", string(msg.Payload())).Msg("Could not parse Zigbee2Mqtt bridge state")
+		return
+	}
+	if online == c.bridgeOnline {
+		return
+	}
+
+	c.bridgeOnline = online
+	if online {
+		log.Info().Str("id", c.conf.Id).Msg("Zigbee2Mqtt bridge online")
+	} else {
+		log.Error().Str("id", c.conf.Id).Msg("Zigbee2Mqtt bridge offline")
+	}
+	c.ctrl.OperationalStateChanged(c)
+}
+
+func (c *Connector) handleBridgeInfo(msg mqtt.Message) {
+	log.Debug().Str("topic", msg.Topic()).Str("payload", string(msg.Payload())).Msg("handleBridgeInfo")
+
+	var info BridgeInfo
+	if err := json.Unmarshal(msg.Payload(), &info); err != nil {
+		log.Error().Err(err).Str("payload", string(msg.Payload())).Msg("Could not parse Zigbee2Mqtt bridge info")
+		return
+	}
+
+	old := c.bridgeInfo
+	c.bridgeInfo = info
+	if old.Version != info.Version || old.Coordinator.Type != info.Coordinator.Type || old.Coordinator.IeeeAddress != info.Coordinator.IeeeAddress {
+		log.Info().Str("id", c.conf.Id).Str("version", info.Version).Str("coordinator", info.Coordinator.Type).Str("coordinatorIeeeAddress", info.Coordinator.IeeeAddress).Msg("Zigbee2Mqtt bridge info")
+	}
+	if old.PermitJoin != info.PermitJoin {
+		log.Info().Str("id", c.conf.Id).Bool("permitJoin", info.PermitJoin).Msg("Zigbee2Mqtt permit join changed")
+	}
+}
+
+// handleBridgeLogging forwards errors of the bridge, e.g. a failing coordinator, to the log.
+func (c *Connector) handleBridgeLogging(msg mqtt.Message) {
+	var entry BridgeLog
+	if err := json.Unmarshal(msg.Payload(), &entry); err != nil {
+		log.Error().Err(err).Str("payload", string(msg.Payload())).Msg("Could not parse Zigbee2Mqtt bridge log")
+		return
+	}
+	if entry.Level == "error" {
+		log.Error().Str("id", c.conf.Id).Str("message", entry.Message).Msg("Zigbee2Mqtt bridge error")
+	}
+}
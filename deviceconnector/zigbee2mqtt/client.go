@@ -0,0 +1,260 @@
+package zigbee2mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/mtrossbach/waechter/internal/log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttClient is the MQTT client of a connection: paho.mqtt.golang for MQTT 3.1 and 3.1.1, paho.golang for MQTT 5.
+// A client is used for a single connection attempt, reconnects create a new one.
+type mqttClient interface {
+	Connect() error
+	Subscribe(topic string) error
+	Unsubscribe(topic string)
+	Publish(topic string, payload []byte)
+	Disconnect()
+}
+
+const (
+	mqttTimeout   = 10 * time.Second
+	mqttKeepAlive = 30
+	// publishQueueSize is the number of MQTT 5 messages waiting to be sent before new ones are dropped
+	publishQueueSize = 100
+)
+
+type v3Client struct {
+	client mqtt.Client
+}
+
+func newV3Client(c *connection) *v3Client {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(c.config.Url)
+	opts.SetClientID(c.config.ClientId)
+	opts.SetUsername(c.config.Username)
+	opts.SetPassword(c.config.Password)
+	if c.config.ProtocolVersion > 0 {
+		opts.SetProtocolVersion(uint(c.config.ProtocolVersion))
+	}
+	if c.tls != nil {
+		opts.SetTLSConfig(c.tls)
+	}
+	// the connection reconnects with backoff itself
+	opts.SetAutoReconnect(false)
+	opts.SetDefaultPublishHandler(func(_ mqtt.Client, msg mqtt.Message) {
+		c.dispatch(msg)
+	})
+	opts.OnConnect = func(mqtt.Client) {
+		c.connected()
+	}
+	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
+		c.connectionLost(err)
+	}
+	return &v3Client{client: mqtt.NewClient(opts)}
+}
+
+func (v *v3Client) Connect() error {
+	token := v.client.Connect()
+	token.Wait()
+	return token.Error()
+}
+
+func (v *v3Client) Subscribe(topic string) error {
+	token := v.client.Subscribe(topic, 1, nil)
+	if !token.WaitTimeout(mqttTimeout) {
+		return errors.New("timeout")
+	}
+	return token.Error()
+}
+
+func (v *v3Client) Unsubscribe(topic string) {
+	v.client.Unsubscribe(topic)
+}
+
+func (v *v3Client) Publish(topic string, payload []byte) {
+	v.client.Publish(topic, 1, false, payload)
+}
+
+func (v *v3Client) Disconnect() {
+	v.client.Disconnect(100)
+}
+
+// v5Client connects via TCP or TLS, websockets are not supported with MQTT 5. Messages are published in order by
+// a single goroutine, so that publishing never blocks the caller while waiting for the acknowledgement.
+type v5Client struct {
+	conn    *connection
+	client  *paho.Client
+	publish chan *paho.Publish
+	stop    chan struct{}
+	lost    sync.Once
+}
+
+func newV5Client(c *connection) *v5Client {
+	return &v5Client{
+		conn:    c,
+		publish: make(chan *paho.Publish, publishQueueSize),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (v *v5Client) Connect() error {
+	nc, err := v.dial()
+	if err != nil {
+		v.lost.Do(func() {})
+		return err
+	}
+
+	conf := v.conn.config
+	v.client = paho.NewClient(paho.ClientConfig{
+		ClientID: conf.ClientId,
+		Conn:     packets.NewThreadSafeConn(nc),
+		Router: paho.NewSingleHandlerRouter(func(p *paho.Publish) {
+			v.conn.dispatch(v5Message{p: p})
+		}),
+		OnClientError: func(err error) {
+			v.connectionLost(err)
+		},
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			v.connectionLost(fmt.Errorf("disconnected by broker with reason code %d", d.ReasonCode))
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+	defer cancel()
+	ca, err := v.client.Connect(ctx, &paho.Connect{
+		ClientID:     conf.ClientId,
+		KeepAlive:    mqttKeepAlive,
+		CleanStart:   true,
+		Username:     conf.Username,
+		UsernameFlag: len(conf.Username) > 0,
+		Password:     []byte(conf.Password),
+		PasswordFlag: len(conf.Password) > 0,
+	})
+	if err == nil && ca.ReasonCode != 0 {
+		err = fmt.Errorf("connection refused with reason code %d", ca.ReasonCode)
+	}
+	if err != nil {
+		v.lost.Do(func() {})
+		_ = nc.Close()
+		return err
+	}
+
+	go v.publisher()
+	go v.conn.connected()
+	return nil
+}
+
+// dial opens the network connection to the broker.
+func (v *v5Client) dial() (net.Conn, error) {
+	u, err := url.Parse(v.conn.config.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		return dialer.Dial("tcp", hostPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		tlsConfig := v.conn.tls
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		return tls.DialWithDialer(dialer, "tcp", hostPort(u, "8883"), tlsConfig)
+	}
+	return nil, fmt.Errorf("scheme %s is not supported with MQTT 5", u.Scheme)
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if len(u.Port()) > 0 {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+func (v *v5Client) Subscribe(topic string) error {
+	if v.client == nil {
+		return errors.New("not connected")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+	defer cancel()
+	_, err := v.client.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{topic: {QoS: 1}},
+	})
+	return err
+}
+
+func (v *v5Client) Unsubscribe(topic string) {
+	if v.client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+	defer cancel()
+	if _, err := v.client.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}}); err != nil {
+		log.Error().Str("topic", topic).Err(err).Msg("Could not unsubscribe")
+	}
+}
+
+func (v *v5Client) Publish(topic string, payload []byte) {
+	select {
+	case v.publish <- &paho.Publish{Topic: topic, QoS: 1, Payload: payload}:
+	default:
+		log.Error().Str("topic", topic).Msg("Publish queue full, dropping message")
+	}
+}
+
+// publisher sends the queued messages until the connection is lost.
+func (v *v5Client) publisher() {
+	for {
+		select {
+		case <-v.stop:
+			return
+		case p := <-v.publish:
+			ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+			if _, err := v.client.Publish(ctx, p); err != nil {
+				log.Error().Str("topic", p.Topic).Err(err).Msg("Could not publish message")
+			}
+			cancel()
+		}
+	}
+}
+
+func (v *v5Client) Disconnect() {
+	v.connectionLost(nil)
+	if v.client != nil {
+		_ = v.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
+
+// connectionLost stops publishing and reports the loss once, a nil error is an intended disconnect.
+func (v *v5Client) connectionLost(err error) {
+	v.lost.Do(func() {
+		close(v.stop)
+		if err != nil {
+			v.conn.connectionLost(err)
+		}
+	})
+}
+
+// v5Message adapts a received MQTT 5 message to the message type of the handlers.
+type v5Message struct {
+	p *paho.Publish
+}
+
+func (m v5Message) Duplicate() bool   { return false }
+func (m v5Message) Qos() byte         { return m.p.QoS }
+func (m v5Message) Retained() bool    { return m.p.Retain }
+func (m v5Message) Topic() string     { return m.p.Topic }
+func (m v5Message) MessageID() uint16 { return m.p.PacketID }
+func (m v5Message) Payload() []byte   { return m.p.Payload }
+func (m v5Message) Ack()              {}
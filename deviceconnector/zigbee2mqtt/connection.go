@@ -1,51 +1,66 @@
 package zigbee2mqtt
 
 import (
+	crand "crypto/rand"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/internal/log"
+	"math/rand"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 type connection struct {
-	config  config.Zigbee2MqttConfig
-	handler map[string]MessageHandler
-	client  mqtt.Client
+	config   config.Zigbee2MqttConfig
+	tls      *tls.Config
+	handler  map[string]MessageHandler
+	client   mqttClient
+	attempts atomic.Int32
 
 	OnConnect        ConnectedHandler
 	OnConnectionLost ConnectionLostHandler
 }
 
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 2 * time.Minute
+)
+
 type MessageHandler func(mqtt.Message)
 
 type ConnectedHandler func(conn *connection)
 type ConnectionLostHandler func(conn *connection, err error)
 
-func newConnection(configuration config.Zigbee2MqttConfig) *connection {
+// newConnection creates a connection, tlsConfig is the loaded TLS configuration of the connector or nil.
+func newConnection(configuration config.Zigbee2MqttConfig, tlsConfig *tls.Config) *connection {
+	if len(configuration.ClientId) == 0 {
+		configuration.ClientId = generateClientId()
+	}
 	return &connection{
 		config:  configuration,
+		tls:     tlsConfig,
 		handler: make(map[string]MessageHandler),
 	}
 }
 
+func (c *connection) newClient() mqttClient {
+	if c.config.ProtocolVersion == 5 {
+		return newV5Client(c)
+	}
+	return newV3Client(c)
+}
+
 func (c *connection) Connect() {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(c.config.Url)
-	opts.SetClientID(c.config.ClientId)
-	opts.SetUsername(c.config.Username)
-	opts.SetPassword(c.config.Password)
-	opts.SetDefaultPublishHandler(c.messageHandler())
-
-	opts.OnConnect = c.onConnectHandler()
-	opts.OnConnectionLost = c.onConnectionLostHandler()
-	c.client = mqtt.NewClient(opts)
-	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+	c.client = c.newClient()
+	if err := c.client.Connect(); err != nil {
 		if c.OnConnectionLost != nil {
-			c.OnConnectionLost(c, token.Error())
+			c.OnConnectionLost(c, err)
 		}
 		go c.reconnect()
 	}
@@ -60,11 +75,11 @@ func (c *connection) Disconnect() {
 	if c.OnConnectionLost != nil {
 		c.OnConnectionLost(c, nil)
 	}
-	c.client.Disconnect(100)
+	c.client.Disconnect()
 }
 
 func (c *connection) DisconnectForReconnect() {
-	c.client.Disconnect(100)
+	c.client.Disconnect()
 	c.reconnect()
 }
 
@@ -78,10 +93,8 @@ func (c *connection) Subscribe(topic string, handler MessageHandler) bool {
 	if c.client == nil {
 		return false
 	}
-	token := c.client.Subscribe(topicName, 1, nil)
-	ok := token.WaitTimeout(10 * time.Second)
-	if token.Error() != nil || !ok {
-		log.Error().Str("topic", topicName).Err(token.Error()).Msg("Could not register handler")
+	if err := c.client.Subscribe(topicName); err != nil {
+		log.Error().Str("topic", topicName).Err(err).Msg("Could not register handler")
 		return false
 	} else {
 		log.Debug().Str("topic", topicName).Msg("Registered handler")
@@ -103,42 +116,58 @@ func (c *connection) Publish(topic string, payload interface{}) {
 		return
 	}
 
-	c.client.Publish(topicName, 1, false, string(data))
+	c.client.Publish(topicName, data)
 	log.Debug().Str("topic", topicName).RawJSON("msg", data).Msg("Sent message.")
 }
 
-func (c *connection) messageHandler() mqtt.MessageHandler {
-	return func(client mqtt.Client, msg mqtt.Message) {
-		handler, ok := c.handler[msg.Topic()]
-		if ok && handler != nil {
-			go handler(msg)
-		} else {
-			log.Error().Str("topic", msg.Topic()).Msg("Could not find handler for message.")
-		}
+// dispatch passes a received message to the handler of its topic.
+func (c *connection) dispatch(msg mqtt.Message) {
+	handler, ok := c.handler[msg.Topic()]
+	if ok && handler != nil {
+		go handler(msg)
+	} else {
+		log.Error().Str("topic", msg.Topic()).Msg("Could not find handler for message.")
 	}
 }
 
-func (c *connection) onConnectHandler() mqtt.OnConnectHandler {
-	return func(client mqtt.Client) {
-		for topic, handler := range c.handler {
-			c.Subscribe(topic, handler)
-		}
-		if c.OnConnect != nil {
-			c.OnConnect(c)
-		}
+// connected restores the subscriptions after the client connected.
+func (c *connection) connected() {
+	c.attempts.Store(0)
+	for topic, handler := range c.handler {
+		c.Subscribe(topic, handler)
+	}
+	if c.OnConnect != nil {
+		c.OnConnect(c)
 	}
 }
 
-func (c *connection) onConnectionLostHandler() mqtt.ConnectionLostHandler {
-	return func(client mqtt.Client, err error) {
-		if c.OnConnectionLost != nil {
-			c.OnConnectionLost(c, err)
-		}
-		go c.reconnect()
+func (c *connection) connectionLost(err error) {
+	if c.OnConnectionLost != nil {
+		c.OnConnectionLost(c, err)
 	}
+	go c.reconnect()
 }
 
+// reconnect waits with exponential backoff and jitter before connecting again.
 func (c *connection) reconnect() {
-	<-time.After(1 * time.Second)
+	attempts := c.attempts.Load()
+	backoff := minReconnectDelay << attempts
+	if backoff > maxReconnectDelay || backoff <= 0 {
+		backoff = maxReconnectDelay
+	} else {
+		c.attempts.CompareAndSwap(attempts, attempts+1)
+	}
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	log.Debug().Str("url", c.config.Url).Dur("delay", delay).Msg("Reconnecting")
+	<-time.After(delay)
 	c.Connect()
 }
+
+// generateClientId returns a client id that is unique per instance, so that two instances do not kick each other
+// off the broker.
+func generateClientId() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 3)
+	_, _ = crand.Read(suffix)
+	return fmt.Sprintf("waechter-%s-%x", hostname, suffix)
+}
@@ -1,6 +1,7 @@
 package zigbee2mqtt
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,6 @@ import (
 	"github.com/mtrossbach/waechter/internal/wslice"
 	"github.com/mtrossbach/waechter/system"
 	"github.com/mtrossbach/waechter/system/alarm"
-	"github.com/mtrossbach/waechter/system/arm"
 	"github.com/mtrossbach/waechter/system/device"
 	"sync"
 	"time"
@@ -21,8 +21,26 @@ type Connector struct {
 	ctrl             system.Controller
 	conn             *connection
 	availableDevices sync.Map //map[device.Id]device.Spec
+	capabilities     sync.Map //map[device.Id]capabilities
+	switches         sync.Map //map[device.Id]switches
+	groups           sync.Map //map[string]Z2MGroup
 	activeDevices    sync.Map //map[device.Id]nil
+	reconciling      sync.Map //map[device.Id]time.Time
+	values           sync.Map //map[sensorKey]any, the last value received per sensor
+	sleepyDevices    sync.Map //map[device.Id]nil, battery powered devices that do not answer state requests
+	offlineMutex     sync.Mutex
+	offline          map[device.Id]*time.Timer // nil once reported unavailable
 	connected        bool
+	bridgeOnline     bool
+	bridgeInfo       BridgeInfo
+}
+
+// reconcileTimeout is the time to wait for the answer to a state request.
+const reconcileTimeout = 10 * time.Second
+
+type sensorKey struct {
+	id     device.Id
+	sensor device.Sensor
 }
 
 func NewConnector(configuration config.Zigbee2MqttConfig) (*Connector, error) {
@@ -38,12 +56,32 @@ func NewConnector(configuration config.Zigbee2MqttConfig) (*Connector, error) {
 		configuration.BaseTopic = "zigbee2mqtt"
 	}
 
+	if configuration.AvailabilityGracePeriod <= 0 {
+		configuration.AvailabilityGracePeriod = 60
+	}
+
+	switch configuration.ProtocolVersion {
+	case 0, 3, 4, 5:
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", configuration.ProtocolVersion)
+	}
+
+	var tlsConfig *tls.Config
+	if configuration.Tls != nil {
+		var err error
+		if tlsConfig, err = configuration.Tls.Load(); err != nil {
+			return nil, fmt.Errorf("could not load TLS configuration: %w", err)
+		}
+	}
+
 	return &Connector{
 		conf:             configuration,
-		conn:             newConnection(configuration),
+		conn:             newConnection(configuration, tlsConfig),
 		availableDevices: sync.Map{},
 		activeDevices:    sync.Map{},
+		offline:          map[device.Id]*time.Timer{},
 		connected:        false,
+		bridgeOnline:     true,
 	}, nil
 }
 
@@ -53,6 +91,10 @@ func (c *Connector) Setup(controller system.Controller) {
 		log.Info().Str("id", c.conf.Id).Str("url", c.conf.Url).Msg("Connected to Zigbee2Mqtt broker")
 		c.connected = true
 		c.ctrl.OperationalStateChanged(c)
+		c.activeDevices.Range(func(key, _ any) bool {
+			c.requestState(key.(device.Id))
+			return true
+		})
 	}
 
 	c.conn.OnConnectionLost = func(conn *connection, err error) {
@@ -62,8 +104,13 @@ func (c *Connector) Setup(controller system.Controller) {
 	}
 
 	log.Debug().Str("id", c.conf.Id).Str("url", c.conf.Url).Msg("Connecting to Zigbee2Mqtt broker...")
-	//c.conn.Subscribe("bridge/info", c.handleDeviceInfo)
+	c.conn.Subscribe("bridge/state", c.handleBridgeState)
+	c.conn.Subscribe("bridge/info", c.handleBridgeInfo)
+	c.conn.Subscribe("bridge/logging", c.handleBridgeLogging)
 	c.conn.Subscribe("bridge/devices", c.handleNewDeviceList)
+	if c.conf.Groups != nil {
+		c.conn.Subscribe("bridge/groups", c.handleGroups)
+	}
 	c.conn.Subscribe("bridge/event", c.handleDeviceEvent)
 	c.conn.Connect()
 
@@ -90,8 +137,9 @@ func (c *Connector) DisplayName() string {
 	return "Zigbee2Mqtt Connector"
 }
 
+// Operational returns true if both the broker and the Zigbee2Mqtt bridge are online.
 func (c *Connector) Operational() bool {
-	return c.connected
+	return c.connected && c.bridgeOnline
 }
 
 func (c *Connector) EnumerateDevices() []device.Spec {
@@ -121,7 +169,9 @@ func (c *Connector) ActivateDevice(id device.Id) error {
 	if !result {
 		return errors.New("could not subscribe to device")
 	}
+	c.conn.Subscribe(availabilityTopic(id), c.availabilityHandler(id))
 	c.ctrl.DeviceAvailable(id)
+	c.requestState(id)
 	return nil
 }
 
@@ -133,53 +183,168 @@ func (c *Connector) DeactivateDevice(id device.Id) error {
 
 	c.activeDevices.Delete(id)
 	c.conn.Unsubscribe(id.Entity())
+	c.conn.Unsubscribe(availabilityTopic(id))
+	c.offlineMutex.Lock()
+	if t := c.offline[id]; t != nil {
+		t.Stop()
+	}
+	delete(c.offline, id)
+	c.offlineMutex.Unlock()
 	c.ctrl.DeviceUnavailable(id)
 	return nil
 }
 
 func (c *Connector) ControlActor(id device.Id, actor device.Actor, value any) bool {
+	if actor.Base() == device.SwitchActor {
+		return c.controlSwitch(id, actor, value)
+	}
+	return c.controlActor(id.Entity(), c.sirenProfile(id), actor, value)
+}
+
+// controlSwitch turns a switch of a device on or off, using value_on and value_off of its state feature.
+func (c *Connector) controlSwitch(id device.Id, actor device.Actor, value any) bool {
+	p, ok := value.(device.SwitchActorPayload)
+	if !ok {
+		log.Error().Str("id", string(id)).Str("actor", string(actor)).Interface("value", value).Msg("Invalid switch payload")
+		return false
+	}
+	var e Exposes
+	if sw, found := c.switches.Load(id); found {
+		e, ok = sw.(switches)[actor]
+	}
+	if !ok {
+		log.Error().Str("id", string(id)).Str("actor", string(actor)).Msg("Unknown switch")
+		return false
+	}
+
+	state := e.ValueOff
+	if p.On {
+		state = e.ValueOn
+	}
+	if state == nil && p.On {
+		state = "ON"
+	} else if state == nil {
+		state = "OFF"
+	}
+	c.publishSet(id.Entity(), map[string]any{e.Property: state})
+	return true
+}
+
+// controlActor controls the actor of a device or of a group, both are addressed by their friendly name.
+func (c *Connector) controlActor(name string, profile config.SirenProfileConfig, actor device.Actor, value any) bool {
 	switch actor {
 	case device.StateActor:
-		c.sendPayload(id, newArmModePayload(c.ctrl.SystemState(), nil))
+		c.publishSet(name, newArmModePayload(c.ctrl.SystemState(), nil))
 		return true
 
 	case device.AlarmActor:
-		if c.ctrl.SystemState().Alarm == alarm.EntryDelay {
+		if a := c.ctrl.SystemState().Alarm; a.IsPending() {
 			go func() {
-				for c.ctrl.SystemState().Alarm == alarm.EntryDelay {
-					c.sendPayload(id, newNotificationShortPayload())
+				for c.ctrl.SystemState().Alarm == a {
+					c.publishSet(name, newNotificationShortPayload(profile))
 					time.Sleep(2 * time.Second)
 				}
 			}()
 		} else {
-			c.sendPayload(id, newWarningPayload(c.ctrl.SystemState().Alarm))
-			time.AfterFunc(100*time.Millisecond, func() {
-				// Resend after 100ms because some sirens do not correctly process payloads during active alarms
-				c.sendPayload(id, newWarningPayload(c.ctrl.SystemState().Alarm))
-			})
+			c.publishSet(name, newWarningPayload(c.sirenAlarm(), profile))
+			if profile.Resend {
+				time.AfterFunc(100*time.Millisecond, func() {
+					// Resend after 100ms because some sirens do not correctly process payloads during active alarms
+					c.publishSet(name, newWarningPayload(c.sirenAlarm(), profile))
+				})
+			}
 		}
 		return true
 	case device.NotificationShortActor:
-		c.sendPayload(id, newNotificationShortPayload())
+		c.publishSet(name, newNotificationShortPayload(profile))
 		return true
 	case device.NotificationLongActor:
-		c.sendPayload(id, newNotificationLongPayload())
+		c.publishSet(name, newNotificationLongPayload(profile))
+		return true
+	case device.SquawkActor:
+		if p, ok := value.(device.SquawkActorPayload); ok {
+			if payload := newSquawkPayload(p.ArmMode, profile); payload != nil {
+				c.publishSet(name, payload)
+			}
+		}
 		return true
 	default:
-		log.Error().Str("device", string(id)).Str("actor", string(actor)).Interface("value", value).Msg("Unknown actor type")
+		log.Error().Str("name", name).Str("actor", string(actor)).Interface("value", value).Msg("Unknown actor type")
 	}
 
 	return false
 }
 
+// sirenAlarm returns the alarm sirens should sound, which is none while the alarm is silenced.
+func (c *Connector) sirenAlarm() alarm.Type {
+	state := c.ctrl.SystemState()
+	if state.Silenced {
+		return alarm.None
+	}
+	return state.Alarm
+}
+
+// requestState asks Zigbee2Mqtt for the current values of the device. The answer is reconciled instead of
+// delivered, so that changes missed while offline are not mistaken for live events. Battery powered devices
+// sleep and never answer, their next message is a live event and must raise alarms, so they are not asked.
+func (c *Connector) requestState(id device.Id) {
+	if _, sleepy := c.sleepyDevices.Load(id); sleepy {
+		return
+	}
+	caps, ok := c.capabilities.Load(id)
+	if !ok {
+		return
+	}
+
+	payload := map[string]string{}
+	for _, e := range caps.(capabilities) {
+		if e.Access&accessGet != 0 {
+			payload[e.Property] = ""
+		}
+	}
+	if len(payload) == 0 {
+		return
+	}
+	c.reconciling.Store(id, time.Now().Add(reconcileTimeout))
+	c.conn.Publish(fmt.Sprintf("%v/get", id.Entity()), payload)
+}
+
+// isReconciling returns true for retained messages and for the first answer after a state request.
+func (c *Connector) isReconciling(id device.Id, msg mqtt.Message) bool {
+	if msg.Retained() {
+		return true
+	}
+	deadline, ok := c.reconciling.LoadAndDelete(id)
+	return ok && time.Now().Before(deadline.(time.Time))
+}
+
+// reconcilesValue records the value and returns true if a value of a reconciling message is reconciled. Values of
+// retained messages are always reconciled. The answer to a state request cannot be told apart from a live message
+// sent right after the request, so its values are only reconciled if they are unchanged or were not known before,
+// e.g. after a restart; changed values are delivered as live events and raise alarms.
+func (c *Connector) reconcilesValue(id device.Id, sensor device.Sensor, value any, retained bool) bool {
+	key := sensorKey{id: id, sensor: sensor}
+	old, known := c.values.Load(key)
+	c.values.Store(key, value)
+	return retained || !known || old == value
+}
+
 func (c *Connector) sendPayload(id device.Id, payload any) {
-	c.conn.Publish(fmt.Sprintf("%v/set", id.Entity()), payload)
+	c.publishSet(id.Entity(), payload)
+}
+
+func (c *Connector) publishSet(name string, payload any) {
+	c.conn.Publish(fmt.Sprintf("%v/set", name), payload)
 }
 
 func (c *Connector) deviceMessageHandler(id device.Id) MessageHandler {
 	return func(msg mqtt.Message) {
 		log.Debug().Str("id", string(id)).Str("topic", msg.Topic()).Str("payload", string(msg.Payload())).Msg("deviceMessageHandler")
 
+		if !msg.Retained() {
+			c.ctrl.DeviceSeen(id)
+		}
+
 		var data map[string]any
 		if err := json.Unmarshal(msg.Payload(), &data); err != nil {
 			log.Error().Str("device", string(id)).Str("payload", string(msg.Payload())).Msg("Could not parse device data")
@@ -192,75 +357,26 @@ func (c *Connector) deviceMessageHandler(id device.Id) MessageHandler {
 			return
 		}
 
-		actionDone := false
-		for _, s := range spec.(device.Spec).Sensors {
-			switch s {
-			case device.Humidity:
-				if v := extract[float64](data, "humidity"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.HumiditySensorValue{Humidity: float32(*v)})
-				}
-			case device.Temperature:
-				if v := extract[float64](data, "temperature"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.TemperatureSensorValue{Temperature: float32(*v)})
-				}
-			case device.MotionSensor:
-				if v := extract[bool](data, "occupancy"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.MotionSensorValue{Motion: *v})
-				}
-			case device.ContactSensor:
-				if v := extract[bool](data, "contact"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.ContactSensorValue{Contact: *v})
-				}
-			case device.SmokeSensor:
-				if v := extract[bool](data, "smoke"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.SmokeSensorValue{Smoke: *v})
-				}
-			case device.BatteryWarningSensor:
-				if v := extract[bool](data, "battery_low"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.BatteryWarningSensorValue{BatteryWarning: *v})
-				}
-			case device.TamperSensor:
-				if v := extract[bool](data, "tamper"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.TamperSensorValues{Tamper: *v})
-				}
-			case device.BatteryLevelSensor:
-				if v := extract[float64](data, "battery"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.BatteryLevelSensorValue{BatteryLevel: float32(*v)})
-				}
-			case device.LinkQualitySensor:
-				if v := extract[float64](data, "linkquality"); v != nil {
-					c.ctrl.DeliverSensorValue(id, s, device.LinkQualitySensorValue{LinkQuality: float32(*v)})
-				}
-			case device.ArmingSensor, device.DisarmingSensor, device.PanicSensor:
-				if msg.Retained() {
+		reconciling := c.isReconciling(id, msg)
+		if caps, ok := c.capabilities.Load(id); ok {
+			for sensor, e := range caps.(capabilities) {
+				v := sensorValue(sensor, e, data)
+				if v == nil {
 					continue
 				}
-				if actionDone {
-					continue
+				if c.reconcilesValue(id, sensor, v, msg.Retained()) && reconciling {
+					c.ctrl.ReconcileSensorValue(id, sensor, v)
 				} else {
-					actionDone = true
-				}
-				if v := extract[string](data, "action"); v != nil && len(*v) > 0 {
-					transactionId := extract[float64](data, "action_transaction")
-					c.sendPayload(id, armModePayload{ArmMode: armMode{
-						Mode:        *v,
-						Transaction: transactionId,
-					}})
-					c.ctrl.DeliverSensorValue(id, s, device.PanicSensorValue{Panic: *v == "panic"})
-
-					if *v == "arm_all_zones" {
-						c.ctrl.DeliverSensorValue(id, device.ArmingSensor, device.ArmingSensorValue{ArmMode: arm.All})
-					} else if *v == "arm_day_zones" || *v == "arm_night_zones" {
-						c.ctrl.DeliverSensorValue(id, device.ArmingSensor, device.ArmingSensorValue{ArmMode: arm.Perimeter})
-					} else if *v == "disarm" {
-						if code := extract[string](data, "action_code"); code != nil {
-							c.ctrl.DeliverSensorValue(id, device.ArmingSensor, device.DisarmingSensorValue{Pin: *code})
-						}
-					}
+					c.ctrl.DeliverSensorValue(id, sensor, v)
 				}
 			}
 		}
 
+		if wslice.Contains(spec.(device.Spec).Sensors, device.ArmingSensor) && !msg.Retained() {
+			if v := extract[string](data, "action"); v != nil && len(*v) > 0 {
+				c.handleKeypadAction(id, *v, extract[string](data, "action_code"), extract[float64](data, "action_transaction"))
+			}
+		}
 	}
 }
 
@@ -277,6 +393,14 @@ func (c *Connector) handleDeviceEvent(msg mqtt.Message) {
 		id := device.NewId(c.Id(), deviceEvent.Data.FriendlyName)
 		c.ctrl.DeviceAvailable(id)
 	}
+
+	if t, ok := pairingEvent(deviceEvent); ok {
+		c.ctrl.DevicePairingEvent(c, system.PairingEvent{
+			Type:        t,
+			Id:          device.NewId(c.Id(), deviceEvent.Data.FriendlyName),
+			IeeeAddress: deviceEvent.Data.IeeeAddress,
+		})
+	}
 }
 
 func (c *Connector) handleNewDeviceList(msg mqtt.Message) {
@@ -297,12 +421,20 @@ func (c *Connector) handleNewDeviceList(msg mqtt.Message) {
 	}
 
 	c.availableDevices = sync.Map{}
+	c.capabilities = sync.Map{}
+	c.switches = sync.Map{}
+	c.sleepyDevices = sync.Map{}
 
 	for _, d := range relevantDevices {
 		if d.InterviewCompleted { // only the device has been interview completed, paired
-			spec := c.specFromDeviceInfo(d)
+			spec, caps, sw := c.specFromDeviceInfo(d)
 			if spec.IsRelevant() {
 				c.availableDevices.Store(spec.Id, spec)
+				c.capabilities.Store(spec.Id, caps)
+				c.switches.Store(spec.Id, sw)
+				if d.PowerSource == "Battery" {
+					c.sleepyDevices.Store(spec.Id, nil)
+				}
 			}
 		}
 	}
@@ -316,73 +448,5 @@ func (c *Connector) handleNewDeviceList(msg mqtt.Message) {
 	})
 
 	c.ctrl.DeviceListUpdated(c)
-}
-
-func (c *Connector) handleDeviceInfo(msg mqtt.Message) {
-	log.Debug().Str("payload", string(msg.Payload())).Str("topic", msg.Topic()).Msg("handleDeviceInfo")
-}
-
-func (c *Connector) specFromDeviceInfo(info Z2MDeviceInfo) device.Spec {
-	spec := device.Spec{
-		Id:          device.NewId(c.Id(), info.FriendlyName),
-		IeeeAddress: info.IeeeAddress,
-		DisplayName: info.FriendlyName,
-		Vendor:      info.Definition.Vendor,
-		Model:       info.Definition.Model,
-		Description: info.Definition.Description,
-		Sensors:     []device.Sensor{},
-		Actors:      []device.Actor{},
-	}
-
-	var exposes []string
-	for _, e := range info.Definition.Exposes {
-		exposes = append(exposes, e.Property)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"action_code", "action"}) {
-		spec.Sensors = append(spec.Sensors, device.ArmingSensor, device.DisarmingSensor, device.PanicSensor)
-		spec.Actors = append(spec.Actors, device.StateActor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"warning"}) {
-		spec.Actors = append(spec.Actors, device.AlarmActor, device.NotificationShortActor, device.NotificationLongActor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"contact"}) {
-		spec.Sensors = append(spec.Sensors, device.ContactSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"smoke"}) {
-		spec.Sensors = append(spec.Sensors, device.SmokeSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"occupancy"}) {
-		spec.Sensors = append(spec.Sensors, device.MotionSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"battery"}) {
-		spec.Sensors = append(spec.Sensors, device.BatteryLevelSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"battery_low"}) {
-		spec.Sensors = append(spec.Sensors, device.BatteryWarningSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"tamper"}) {
-		spec.Sensors = append(spec.Sensors, device.TamperSensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"linkquality"}) {
-		spec.Sensors = append(spec.Sensors, device.LinkQualitySensor)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"humidity"}) {
-		spec.Sensors = append(spec.Sensors, device.Humidity)
-	}
-
-	if wslice.ContainsAll(exposes, []string{"temperature"}) {
-		spec.Sensors = append(spec.Sensors, device.Temperature)
-	}
-
-	return spec
+	c.checkGroups()
 }
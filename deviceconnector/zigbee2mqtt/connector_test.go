@@ -0,0 +1,96 @@
+package zigbee2mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+type testMessage struct {
+	retained bool
+}
+
+func (m testMessage) Duplicate() bool   { return false }
+func (m testMessage) Qos() byte         { return 1 }
+func (m testMessage) Retained() bool    { return m.retained }
+func (m testMessage) Topic() string     { return "zigbee2mqtt/Door" }
+func (m testMessage) MessageID() uint16 { return 0 }
+func (m testMessage) Payload() []byte   { return []byte("{}") }
+func (m testMessage) Ack()              {}
+
+func TestIsReconciling(t *testing.T) {
+	id := device.NewId("z2m", "Door")
+
+	tests := []struct {
+		name     string
+		sleepy   bool
+		request  bool
+		expired  bool
+		retained []bool
+		want     []bool
+	}{
+		{name: "retained message", retained: []bool{true}, want: []bool{true}},
+		{name: "live message", retained: []bool{false}, want: []bool{false}},
+		{name: "answer to state request", request: true, retained: []bool{false}, want: []bool{true}},
+		{name: "live message after answer", request: true, retained: []bool{false, false}, want: []bool{true, false}},
+		{name: "answer after timeout", request: true, expired: true, retained: []bool{false}, want: []bool{false}},
+		{name: "battery device is not asked", sleepy: true, request: true, retained: []bool{false}, want: []bool{false}},
+		{name: "retained battery message", sleepy: true, request: true, retained: []bool{true, false}, want: []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connector{conn: newConnection(config.Zigbee2MqttConfig{BaseTopic: "zigbee2mqtt"}, nil)}
+			c.conn.client = newV3Client(c.conn)
+			c.capabilities.Store(id, capabilities{device.ContactSensor: {Property: "contact", Access: accessGet}})
+			if tt.sleepy {
+				c.sleepyDevices.Store(id, nil)
+			}
+			if tt.request {
+				c.requestState(id)
+			}
+			if tt.expired {
+				c.reconciling.Store(id, time.Now().Add(-time.Second))
+			}
+
+			for i, retained := range tt.retained {
+				if got := c.isReconciling(id, testMessage{retained: retained}); got != tt.want[i] {
+					t.Errorf("message %d: isReconciling() = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReconcilesValue(t *testing.T) {
+	id := device.NewId("z2m", "Door")
+	closed := device.ContactSensorValue{Contact: true}
+	open := device.ContactSensorValue{Contact: false}
+
+	tests := []struct {
+		name     string
+		known    any
+		value    any
+		retained bool
+		want     bool
+	}{
+		{name: "unknown value after restart", value: open, want: true},
+		{name: "unchanged value", known: closed, value: closed, want: true},
+		{name: "changed value is a live event", known: closed, value: open, want: false},
+		{name: "changed retained value", known: closed, value: open, retained: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connector{}
+			if tt.known != nil {
+				c.reconcilesValue(id, device.ContactSensor, tt.known, false)
+			}
+			if got := c.reconcilesValue(id, device.ContactSensor, tt.value, tt.retained); got != tt.want {
+				t.Errorf("reconcilesValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package zigbee2mqtt
+
+import (
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+// access bits of exposed features
+const (
+	accessState = 1
+	accessSet   = 2
+	accessGet   = 4
+)
+
+// exposedSensors maps the names of exposed features to sensors.
+var exposedSensors = map[string]device.Sensor{
+	"occupancy":   device.MotionSensor,
+	"contact":     device.ContactSensor,
+	"smoke":       device.SmokeSensor,
+	"vibration":   device.VibrationSensor,
+	"battery_low": device.BatteryWarningSensor,
+	"tamper":      device.TamperSensor,
+	"battery":     device.BatteryLevelSensor,
+	"linkquality": device.LinkQualitySensor,
+	"humidity":    device.Humidity,
+	"temperature": device.Temperature,
+}
+
+// capabilities maps the sensors of a device to the features providing their values.
+type capabilities map[device.Sensor]Exposes
+
+// switches maps the switch actors of a device to the state features controlling them.
+type switches map[device.Actor]Exposes
+
+// walkExposes calls f for every expose and, recursively, for every feature with the expose containing it.
+func walkExposes(exposes []Exposes, parent *Exposes, f func(e Exposes, parent *Exposes)) {
+	for i := range exposes {
+		f(exposes[i], parent)
+		walkExposes(exposes[i].Features, &exposes[i], f)
+	}
+}
+
+// sensorFor returns the sensor provided by an exposed feature.
+func sensorFor(e Exposes, parent *Exposes) (device.Sensor, bool) {
+	if parent != nil && parent.Type == "lock" && e.Name == "state" {
+		return device.LockSensor, true
+	}
+	s, ok := exposedSensors[e.Name]
+	return s, ok
+}
+
+// isSwitch returns true for the settable state feature of a switch expose.
+func isSwitch(e Exposes, parent *Exposes) bool {
+	return parent != nil && parent.Type == "switch" && e.Name == "state" && e.Access&accessSet != 0
+}
+
+func (c *Connector) specFromDeviceInfo(info Z2MDeviceInfo) (device.Spec, capabilities, switches) {
+	spec := device.Spec{
+		Id:          device.NewId(c.Id(), info.FriendlyName),
+		IeeeAddress: info.IeeeAddress,
+		DisplayName: info.FriendlyName,
+		Vendor:      info.Definition.Vendor,
+		Model:       info.Definition.Model,
+		Description: info.Definition.Description,
+		Sensors:     []device.Sensor{},
+		Actors:      []device.Actor{},
+	}
+
+	names := map[string]bool{}
+	var features []Exposes
+	var parents []*Exposes
+	endpoints := map[device.Sensor]int{}
+	var switchFeatures []Exposes
+	walkExposes(info.Definition.Exposes, nil, func(e Exposes, parent *Exposes) {
+		names[e.Name] = true
+		if s, ok := sensorFor(e, parent); ok && e.Access&accessState != 0 {
+			features = append(features, e)
+			parents = append(parents, parent)
+			endpoints[s]++
+		}
+		if isSwitch(e, parent) {
+			switchFeatures = append(switchFeatures, e)
+		}
+		switch e.Name {
+		case "warning":
+			if e.Access&accessSet != 0 {
+				spec.Actors = append(spec.Actors, device.AlarmActor, device.NotificationShortActor, device.NotificationLongActor)
+			}
+		case "squawk":
+			if e.Access&accessSet != 0 {
+				spec.Actors = append(spec.Actors, device.SquawkActor)
+			}
+		}
+	})
+
+	if names["action"] && names["action_code"] {
+		spec.Sensors = append(spec.Sensors, device.ArmingSensor, device.DisarmingSensor, device.PanicSensor, device.FireSensor,
+			device.SilencingSensor, device.ResettingSensor, device.WalkTestSensor, device.MaintenanceSensor)
+		spec.Actors = append(spec.Actors, device.StateActor)
+	}
+
+	// features of the same kind on several endpoints become separate sensors
+	caps := capabilities{}
+	for i, e := range features {
+		s, _ := sensorFor(e, parents[i])
+		if endpoints[s] > 1 && len(e.Endpoint) > 0 {
+			s = device.EndpointSensor(s, e.Endpoint)
+		}
+		if existing, ok := caps[s]; ok {
+			log.Warn().Str("device", info.FriendlyName).Str("sensor", string(s)).Str("property", e.Property).Str("used", existing.Property).Msg("Several features map to the same sensor, ignoring all but the first")
+			continue
+		}
+		caps[s] = e
+		spec.Sensors = append(spec.Sensors, s)
+	}
+
+	// switches on several endpoints become separate actors
+	sw := switches{}
+	for _, e := range switchFeatures {
+		a := device.SwitchActor
+		if len(switchFeatures) > 1 && len(e.Endpoint) > 0 {
+			a = device.EndpointActor(a, e.Endpoint)
+		}
+		if _, ok := sw[a]; ok {
+			log.Warn().Str("device", info.FriendlyName).Str("actor", string(a)).Str("property", e.Property).Msg("Several switches map to the same actor, ignoring all but the first")
+			continue
+		}
+		sw[a] = e
+		spec.Actors = append(spec.Actors, a)
+	}
+
+	return spec, caps, sw
+}
+
+// binaryValue returns the state of a binary feature, using value_on if given.
+func binaryValue(e Exposes, raw any) (bool, bool) {
+	if e.ValueOn != nil {
+		return raw == e.ValueOn, true
+	}
+	v, ok := raw.(bool)
+	return v, ok
+}
+
+// sensorValue converts the value of an exposed feature from the device data. It returns nil if the data does
+// not contain the feature.
+func sensorValue(sensor device.Sensor, e Exposes, data map[string]any) any {
+	raw, ok := data[e.Property]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	switch sensor.Base() {
+	case device.MotionSensor, device.ContactSensor, device.SmokeSensor, device.VibrationSensor, device.BatteryWarningSensor,
+		device.TamperSensor, device.LockSensor:
+		on, ok := binaryValue(e, raw)
+		if !ok {
+			return nil
+		}
+		switch sensor.Base() {
+		case device.MotionSensor:
+			return device.MotionSensorValue{Motion: on}
+		case device.ContactSensor:
+			return device.ContactSensorValue{Contact: on}
+		case device.SmokeSensor:
+			return device.SmokeSensorValue{Smoke: on}
+		case device.VibrationSensor:
+			return device.VibrationSensorValue{Vibration: on}
+		case device.BatteryWarningSensor:
+			return device.BatteryWarningSensorValue{BatteryWarning: on}
+		case device.TamperSensor:
+			return device.TamperSensorValues{Tamper: on}
+		case device.LockSensor:
+			return device.LockSensorValue{Locked: on}
+		}
+
+	default:
+		v, ok := raw.(float64)
+		if !ok {
+			return nil
+		}
+		switch sensor.Base() {
+		case device.BatteryLevelSensor:
+			return device.BatteryLevelSensorValue{BatteryLevel: float32(v)}
+		case device.LinkQualitySensor:
+			return device.LinkQualitySensorValue{LinkQuality: float32(v)}
+		case device.Humidity:
+			return device.HumiditySensorValue{Humidity: float32(v)}
+		case device.Temperature:
+			return device.TemperatureSensorValue{Temperature: float32(v)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package zigbee2mqtt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+func TestSpecFromDeviceInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		exposes     string
+		wantSensors []device.Sensor
+		wantActors  []device.Actor
+		wantProps   map[device.Sensor]string
+	}{
+		{
+			name:        "contact sensor",
+			exposes:     `[{"type":"binary","name":"contact","property":"contact","access":1,"value_on":false,"value_off":true},{"type":"numeric","name":"battery","property":"battery","access":1}]`,
+			wantSensors: []device.Sensor{device.ContactSensor, device.BatteryLevelSensor},
+			wantActors:  []device.Actor{},
+			wantProps:   map[device.Sensor]string{device.ContactSensor: "contact"},
+		},
+		{
+			name:        "feature without state access",
+			exposes:     `[{"type":"binary","name":"occupancy","property":"occupancy","access":2}]`,
+			wantSensors: []device.Sensor{},
+			wantActors:  []device.Actor{},
+		},
+		{
+			name:        "nested siren warning",
+			exposes:     `[{"type":"composite","name":"warning","property":"warning","access":2,"features":[{"type":"enum","name":"mode","property":"mode","access":2,"values":["stop","burglar"]}]},{"type":"composite","name":"squawk","property":"squawk","access":2}]`,
+			wantSensors: []device.Sensor{},
+			wantActors:  []device.Actor{device.AlarmActor, device.NotificationShortActor, device.NotificationLongActor, device.SquawkActor},
+		},
+		{
+			name:        "lock state",
+			exposes:     `[{"type":"lock","features":[{"type":"binary","name":"state","property":"state","access":7,"value_on":"LOCK","value_off":"UNLOCK"}]}]`,
+			wantSensors: []device.Sensor{device.LockSensor},
+			wantActors:  []device.Actor{},
+			wantProps:   map[device.Sensor]string{device.LockSensor: "state"},
+		},
+		{
+			name:        "contacts on several endpoints",
+			exposes:     `[{"type":"binary","name":"contact","property":"contact_l1","endpoint":"l1","access":1},{"type":"binary","name":"contact","property":"contact_l2","endpoint":"l2","access":1}]`,
+			wantSensors: []device.Sensor{device.EndpointSensor(device.ContactSensor, "l1"), device.EndpointSensor(device.ContactSensor, "l2")},
+			wantActors:  []device.Actor{},
+			wantProps: map[device.Sensor]string{
+				device.EndpointSensor(device.ContactSensor, "l1"): "contact_l1",
+				device.EndpointSensor(device.ContactSensor, "l2"): "contact_l2",
+			},
+		},
+		{
+			name:        "duplicate sensor keeps the first feature",
+			exposes:     `[{"type":"binary","name":"contact","property":"contact","access":1},{"type":"binary","name":"contact","property":"contact_2","access":1}]`,
+			wantSensors: []device.Sensor{device.ContactSensor},
+			wantActors:  []device.Actor{},
+			wantProps:   map[device.Sensor]string{device.ContactSensor: "contact"},
+		},
+		{
+			name:        "single switch",
+			exposes:     `[{"type":"switch","features":[{"type":"binary","name":"state","property":"state","access":7,"value_on":"ON","value_off":"OFF"}]}]`,
+			wantSensors: []device.Sensor{},
+			wantActors:  []device.Actor{device.SwitchActor},
+		},
+		{
+			name:        "switches on several endpoints",
+			exposes:     `[{"type":"switch","endpoint":"l1","features":[{"type":"binary","name":"state","property":"state_l1","endpoint":"l1","access":7}]},{"type":"switch","endpoint":"l2","features":[{"type":"binary","name":"state","property":"state_l2","endpoint":"l2","access":7}]}]`,
+			wantSensors: []device.Sensor{},
+			wantActors:  []device.Actor{device.EndpointActor(device.SwitchActor, "l1"), device.EndpointActor(device.SwitchActor, "l2")},
+		},
+		{
+			name:        "read only switch",
+			exposes:     `[{"type":"switch","features":[{"type":"binary","name":"state","property":"state","access":1}]}]`,
+			wantSensors: []device.Sensor{},
+			wantActors:  []device.Actor{},
+		},
+	}
+
+	c := &Connector{conf: config.Zigbee2MqttConfig{Id: "z2m"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exposes []Exposes
+			if err := json.Unmarshal([]byte(tt.exposes), &exposes); err != nil {
+				t.Fatalf("invalid exposes: %v", err)
+			}
+			spec, caps, _ := c.specFromDeviceInfo(Z2MDeviceInfo{FriendlyName: "Device", Definition: Definition{Exposes: exposes}})
+
+			if !reflect.DeepEqual(spec.Sensors, tt.wantSensors) {
+				t.Errorf("sensors = %v, want %v", spec.Sensors, tt.wantSensors)
+			}
+			if !reflect.DeepEqual(spec.Actors, tt.wantActors) {
+				t.Errorf("actors = %v, want %v", spec.Actors, tt.wantActors)
+			}
+			for s, property := range tt.wantProps {
+				if caps[s].Property != property {
+					t.Errorf("property of %v = %q, want %q", s, caps[s].Property, property)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package zigbee2mqtt
+
+import (
+	"encoding/json"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/device"
+	"strings"
+)
+
+// groupForActor returns the configured group controlling the actor, or an empty string.
+func (c *Connector) groupForActor(actor device.Actor) string {
+	if c.conf.Groups == nil {
+		return ""
+	}
+	switch actor {
+	case device.AlarmActor, device.NotificationShortActor, device.NotificationLongActor, device.SquawkActor:
+		return c.conf.Groups.Sirens
+	case device.StateActor:
+		return c.conf.Groups.Keypads
+	}
+	return ""
+}
+
+// groupMember returns true if the device is a member of the group. Sirens with their own profile are never
+// controlled through the group, as the group only gets the default payloads.
+func (c *Connector) groupMember(group Z2MGroup, id device.Id, actor device.Actor) bool {
+	if actor != device.StateActor && c.configuredSirenProfile(id) != nil {
+		return false
+	}
+	spec, ok := c.availableDevices.Load(id)
+	if !ok {
+		return false
+	}
+	for _, m := range group.Members {
+		if strings.EqualFold(m.IeeeAddress, spec.(device.Spec).IeeeAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Connector) ControlActorGroup(ids []device.Id, actor device.Actor, value any) []device.Id {
+	name := c.groupForActor(actor)
+	if len(name) == 0 {
+		return nil
+	}
+	g, ok := c.groups.Load(name)
+	if !ok {
+		return nil
+	}
+
+	var members []device.Id
+	for _, id := range ids {
+		if c.groupMember(g.(Z2MGroup), id, actor) {
+			members = append(members, id)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	log.Debug().Str("group", name).Str("actor", string(actor)).Int("members", len(members)).Msg("Controlling actor through group")
+	c.controlActor(name, defaultSirenProfile, actor, value)
+	return members
+}
+
+func (c *Connector) handleGroups(msg mqtt.Message) {
+	log.Debug().Str("topic", msg.Topic()).Str("payload", string(msg.Payload())).Msg("handleGroups")
+
+	var groups []Z2MGroup
+	if err := json.Unmarshal(msg.Payload(), &groups); err != nil {
+		log.Error().Err(err).Str("payload", string(msg.Payload())).Msg("Could not parse Zigbee2Mqtt groups")
+		return
+	}
+
+	for _, g := range groups {
+		c.groups.Store(g.FriendlyName, g)
+	}
+	c.checkGroups()
+}
+
+// checkGroups verifies that the configured groups exist and contain all sirens and keypads. With auto create,
+// missing groups are created and missing members are added, otherwise they are logged.
+func (c *Connector) checkGroups() {
+	if c.conf.Groups == nil {
+		return
+	}
+
+	for _, actor := range []device.Actor{device.AlarmActor, device.StateActor} {
+		name := c.groupForActor(actor)
+		if len(name) == 0 {
+			continue
+		}
+
+		g, ok := c.groups.Load(name)
+		if !ok {
+			if c.conf.Groups.AutoCreate {
+				log.Info().Str("group", name).Msg("Creating Zigbee2Mqtt group")
+				c.conn.Publish("bridge/request/group/add", map[string]string{"friendly_name": name})
+			} else {
+				log.Error().Str("group", name).Msg("Zigbee2Mqtt group does not exist")
+			}
+			continue
+		}
+
+		c.activeDevices.Range(func(key, _ any) bool {
+			id := key.(device.Id)
+			spec, ok := c.availableDevices.Load(id)
+			if !ok || !wslice.Contains(spec.(device.Spec).Actors, actor) {
+				return true
+			}
+			if actor != device.StateActor && c.configuredSirenProfile(id) != nil {
+				return true
+			}
+			if c.groupMember(g.(Z2MGroup), id, actor) {
+				return true
+			}
+			if c.conf.Groups.AutoCreate {
+				log.Info().Str("group", name).Str("device", string(id)).Msg("Adding device to Zigbee2Mqtt group")
+				c.conn.Publish("bridge/request/group/members/add", map[string]string{"group": name, "device": id.Entity()})
+			} else {
+				log.Warn().Str("group", name).Str("device", string(id)).Msg("Device is not a member of the Zigbee2Mqtt group and is controlled directly")
+			}
+			return true
+		})
+	}
+}
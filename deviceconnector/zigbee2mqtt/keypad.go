@@ -0,0 +1,132 @@
+package zigbee2mqtt
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+type keypadCommand string
+
+const (
+	armAllCommand       keypadCommand = "arm_all"
+	armPerimeterCommand keypadCommand = "arm_perimeter"
+	disarmCommand       keypadCommand = "disarm"
+	panicCommand        keypadCommand = "panic"
+	fireCommand         keypadCommand = "fire"
+	silenceCommand      keypadCommand = "silence"
+	resetCommand        keypadCommand = "reset"
+	acknowledgeCommand  keypadCommand = "acknowledge"
+	walkTestCommand     keypadCommand = "walk_test"
+	maintenanceCommand  keypadCommand = "maintenance"
+	ignoreCommand       keypadCommand = "ignore"
+)
+
+// defaultKeypadActions maps the actions of keypads without a configured mapping.
+var defaultKeypadActions = map[string]keypadCommand{
+	"arm_all_zones":   armAllCommand,
+	"arm_day_zones":   armPerimeterCommand,
+	"arm_night_zones": armPerimeterCommand,
+	"disarm":          disarmCommand,
+	"panic":           panicCommand,
+	"emergency":       panicCommand,
+	"fire":            fireCommand,
+}
+
+// keypadProfile returns the profile configured for the device or, if there is none, for its model.
+func (c *Connector) keypadProfile(id device.Id) config.KeypadProfileConfig {
+	var model string
+	if spec, ok := c.availableDevices.Load(id); ok {
+		model = spec.(device.Spec).Model
+	}
+
+	var result *config.KeypadProfileConfig
+	for i, p := range c.conf.Keypads {
+		if len(p.Device) > 0 && p.Device == id.Entity() {
+			return c.conf.Keypads[i]
+		}
+		if result == nil && len(p.Device) == 0 && len(p.Model) > 0 && p.Model == model {
+			result = &c.conf.Keypads[i]
+		}
+	}
+	if result != nil {
+		return *result
+	}
+	return config.KeypadProfileConfig{}
+}
+
+// handleKeypadAction delivers a keypad action and answers with the resulting system state, or with
+// "invalid_code" or "not_ready" if the action was refused.
+func (c *Connector) handleKeypadAction(id device.Id, action string, code *string, transactionId *float64) {
+	profile := c.keypadProfile(id)
+	command, ok := keypadCommand(profile.Actions[action]), len(profile.Actions[action]) > 0
+	if !ok {
+		command, ok = defaultKeypadActions[action]
+	}
+	if !ok || command == ignoreCommand {
+		log.Debug().Str("device", string(id)).Str("action", action).Msg("Ignoring keypad action")
+		return
+	}
+
+	pin := ""
+	if code != nil {
+		pin = *code
+	}
+
+	var accepted bool
+	switch command {
+	case armAllCommand, armPerimeterCommand:
+		mode := arm.All
+		if command == armPerimeterCommand {
+			mode = arm.Perimeter
+		}
+		if len(profile.ArmMode) > 0 {
+			mode = arm.Mode(profile.ArmMode)
+		}
+		accepted = c.ctrl.DeliverSensorValue(id, device.ArmingSensor, device.ArmingSensorValue{ArmMode: mode, Pin: pin, PinRequired: profile.RequirePin})
+		if !accepted && !(profile.RequirePin && !validPin(pin)) {
+			c.sendPayload(id, armModePayload{ArmMode: armMode{Mode: "not_ready", Transaction: transactionId}})
+			return
+		}
+	case disarmCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.DisarmingSensor, device.DisarmingSensorValue{Pin: pin})
+	case panicCommand:
+		// reset right away, every press raises a panic alarm
+		c.ctrl.DeliverSensorValue(id, device.PanicSensor, device.PanicSensorValue{Panic: true})
+		c.ctrl.DeliverSensorValue(id, device.PanicSensor, device.PanicSensorValue{Panic: false})
+		accepted = true
+	case fireCommand:
+		c.ctrl.DeliverSensorValue(id, device.FireSensor, device.FireSensorValue{Fire: true})
+		accepted = true
+	case silenceCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.SilencingSensor, device.SilencingSensorValue{Pin: pin})
+	case resetCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.ResettingSensor, device.ResettingSensorValue{Pin: pin})
+	case acknowledgeCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.AcknowledgingSensor, device.AcknowledgingSensorValue{Pin: pin})
+	case walkTestCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.WalkTestSensor, device.WalkTestSensorValue{Pin: pin})
+	case maintenanceCommand:
+		accepted = c.ctrl.DeliverSensorValue(id, device.MaintenanceSensor, device.MaintenanceSensorValue{Pin: pin})
+	default:
+		log.Error().Str("device", string(id)).Str("action", action).Str("command", string(command)).Msg("Unknown keypad command")
+		return
+	}
+
+	if !accepted && !validPin(pin) {
+		c.sendPayload(id, armModePayload{ArmMode: armMode{Mode: "invalid_code", Transaction: transactionId}})
+		return
+	}
+	if !accepted {
+		c.sendPayload(id, armModePayload{ArmMode: armMode{Mode: "not_ready", Transaction: transactionId}})
+		return
+	}
+	c.sendPayload(id, newArmModePayload(c.ctrl.SystemState(), transactionId))
+}
+
+func validPin(pin string) bool {
+	person, _ := wslice.FilterOne(config.Persons(), func(p config.Person) bool { return p.Pin == pin })
+	return len(pin) > 0 && person != nil
+}
@@ -0,0 +1,62 @@
+package zigbee2mqtt
+
+import (
+	"errors"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system"
+	"github.com/mtrossbach/waechter/system/device"
+	"time"
+)
+
+var errNotOperational = errors.New("zigbee2mqtt not operational")
+
+func (c *Connector) PermitJoin(duration time.Duration) error {
+	if !c.Operational() {
+		return errNotOperational
+	}
+	log.Info().Dur("duration", duration).Msg("Permit joining")
+	c.conn.Publish("bridge/request/permit_join", map[string]any{
+		"value": duration > 0,
+		"time":  int(duration.Seconds()),
+	})
+	return nil
+}
+
+func (c *Connector) RenameDevice(id device.Id, name string) error {
+	if !c.Operational() {
+		return errNotOperational
+	}
+	c.conn.Publish("bridge/request/device/rename", map[string]string{
+		"from": id.Entity(),
+		"to":   name,
+	})
+	return nil
+}
+
+func (c *Connector) RemoveDevice(id device.Id) error {
+	if !c.Operational() {
+		return errNotOperational
+	}
+	c.conn.Publish("bridge/request/device/remove", map[string]string{"id": id.Entity()})
+	return nil
+}
+
+// pairingEvent maps the events of bridge/event to pairing events, ok is false for all other events.
+func pairingEvent(event DeviceEvent) (system.PairingEventType, bool) {
+	switch event.Type {
+	case "device_joined":
+		return system.DeviceJoined, true
+	case "device_leave":
+		return system.DeviceLeft, true
+	case "device_interview":
+		switch event.Data.Status {
+		case "started":
+			return system.DeviceInterviewStarted, true
+		case "successful":
+			return system.DeviceInterviewed, true
+		case "failed":
+			return system.DeviceInterviewFailed, true
+		}
+	}
+	return "", false
+}
@@ -1,9 +1,11 @@
 package zigbee2mqtt
 
 import (
+	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/system"
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/arm"
+	"time"
 )
 
 func extract[T any](m map[string]any, key string) *T {
@@ -30,15 +32,21 @@ func newArmModePayload(state system.State, transactionId *float64) armModePayloa
 
 	switch state.Alarm {
 	case alarm.None:
+		exitDelay := time.Duration(config.General().ExitDelay) * time.Second
 		switch state.ArmMode {
 		case arm.Disarmed:
 			mode = "disarm"
-		case arm.Perimeter:
-			mode = "arm_day_zones"
 		default:
-			mode = "arm_all_zones"
+			if time.Now().Sub(state.ArmModeUpdated) < exitDelay {
+				mode = "exit_delay"
+			} else if state.ArmMode == arm.Perimeter {
+				mode = "arm_day_zones"
+			} else {
+				mode = "arm_all_zones"
+			}
 		}
-	case alarm.EntryDelay:
+	case alarm.EntryDelay, alarm.FireVerification:
+		// keypads have no dedicated pre-alarm mode
 		mode = "entry_delay"
 	case alarm.Panic:
 		mode = "panic"
@@ -82,7 +90,10 @@ type warningOptions struct {
 	Duration        int   `json:"duration"`
 }
 
-func newNotificationShortPayload() warningPayload {
+func newNotificationShortPayload(profile config.SirenProfileConfig) warningPayload {
+	if profile.NotificationShort != nil {
+		return newConfiguredWarningPayload(*profile.NotificationShort)
+	}
 	return warningPayload{
 		Warning: warningOptions{
 			Mode:            fire,
@@ -95,7 +106,10 @@ func newNotificationShortPayload() warningPayload {
 	}
 }
 
-func newNotificationLongPayload() warningPayload {
+func newNotificationLongPayload(profile config.SirenProfileConfig) warningPayload {
+	if profile.NotificationLong != nil {
+		return newConfiguredWarningPayload(*profile.NotificationLong)
+	}
 	return warningPayload{
 		Warning: warningOptions{
 			Mode:            emergency,
@@ -108,7 +122,11 @@ func newNotificationLongPayload() warningPayload {
 	}
 }
 
-func newWarningPayload(a alarm.Type) warningPayload {
+func newWarningPayload(a alarm.Type, profile config.SirenProfileConfig) warningPayload {
+	if wc, ok := profile.Alarms[string(a)]; ok {
+		return newConfiguredWarningPayload(wc)
+	}
+
 	mode := stop
 	switch a {
 	case alarm.Burglar, alarm.Tamper, alarm.TamperPin:
@@ -132,3 +150,54 @@ func newWarningPayload(a alarm.Type) warningPayload {
 		},
 	}
 }
+
+func newConfiguredWarningPayload(wc config.WarningConfig) warningPayload {
+	return warningPayload{
+		Warning: warningOptions{
+			Mode:            mode(wc.Mode),
+			Level:           level(wc.Level),
+			StrobeLevel:     level(wc.StrobeLevel),
+			Strobe:          wc.Strobe,
+			StrobeDutyCycle: wc.StrobeDutyCycle,
+			Duration:        wc.Duration,
+		},
+	}
+}
+
+type squawkPayload struct {
+	Squawk squawkOptions `json:"squawk"`
+}
+
+type squawkOptions struct {
+	State  string `json:"state"`
+	Level  level  `json:"level"`
+	Strobe bool   `json:"strobe"`
+}
+
+// newSquawkPayload returns the arm/disarm confirmation of the profile or nil if it is not enabled.
+func newSquawkPayload(armMode arm.Mode, profile config.SirenProfileConfig) *squawkPayload {
+	sc := profile.Squawk
+	if sc == nil {
+		return nil
+	}
+
+	state := "system_is_armed"
+	if armMode == arm.Disarmed {
+		if !sc.Disarm {
+			return nil
+		}
+		state = "system_is_disarmed"
+	} else if !sc.Arm {
+		return nil
+	}
+
+	l := level(sc.Level)
+	if len(l) == 0 {
+		l = low
+	}
+	return &squawkPayload{Squawk: squawkOptions{
+		State:  state,
+		Level:  l,
+		Strobe: sc.Strobe,
+	}}
+}
@@ -0,0 +1,36 @@
+package zigbee2mqtt
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+// defaultSirenProfile is used for sirens without a configured profile. It resends alarm payloads, which some
+// sirens need during active alarms.
+var defaultSirenProfile = config.SirenProfileConfig{Resend: true}
+
+// sirenProfile returns the profile configured for the device or, if there is none, for its model.
+func (c *Connector) sirenProfile(id device.Id) config.SirenProfileConfig {
+	if p := c.configuredSirenProfile(id); p != nil {
+		return *p
+	}
+	return defaultSirenProfile
+}
+
+func (c *Connector) configuredSirenProfile(id device.Id) *config.SirenProfileConfig {
+	var model string
+	if spec, ok := c.availableDevices.Load(id); ok {
+		model = spec.(device.Spec).Model
+	}
+
+	var result *config.SirenProfileConfig
+	for i, p := range c.conf.Sirens {
+		if len(p.Device) > 0 && p.Device == id.Entity() {
+			return &c.conf.Sirens[i]
+		}
+		if result == nil && len(p.Device) == 0 && len(p.Model) > 0 && p.Model == model {
+			result = &c.conf.Sirens[i]
+		}
+	}
+	return result
+}
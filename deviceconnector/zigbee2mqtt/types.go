@@ -26,10 +26,23 @@ type Definition struct {
 	Exposes     []Exposes `json:"exposes"`
 }
 
+// Exposes describes a feature of a device. Composite and specific exposes (e.g. lock, switch) contain their
+// features, which are exposes themselves.
 type Exposes struct {
-	Name     string `json:"name"`
-	Property string `json:"property"`
-	Type     string `json:"type"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Label       string    `json:"label,omitempty"`
+	Property    string    `json:"property"`
+	Access      int       `json:"access"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	Unit        string    `json:"unit,omitempty"`
+	ValueOn     any       `json:"value_on,omitempty"`
+	ValueOff    any       `json:"value_off,omitempty"`
+	ValueMin    *float64  `json:"value_min,omitempty"`
+	ValueMax    *float64  `json:"value_max,omitempty"`
+	Values      []string  `json:"values,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Features    []Exposes `json:"features,omitempty"`
 }
 type Options struct {
 	Name     string `json:"name"`
@@ -37,6 +50,36 @@ type Options struct {
 	Type     string `json:"type"`
 }
 
+type BridgeInfo struct {
+	Version     string      `json:"version"`
+	Commit      string      `json:"commit"`
+	Coordinator Coordinator `json:"coordinator"`
+	PermitJoin  bool        `json:"permit_join"`
+	LogLevel    string      `json:"log_level"`
+}
+
+type Coordinator struct {
+	Type        string         `json:"type"`
+	IeeeAddress string         `json:"ieee_address"`
+	Meta        map[string]any `json:"meta"`
+}
+
+type Z2MGroup struct {
+	Id           int           `json:"id"`
+	FriendlyName string        `json:"friendly_name"`
+	Members      []GroupMember `json:"members"`
+}
+
+type GroupMember struct {
+	IeeeAddress string `json:"ieee_address"`
+	Endpoint    int    `json:"endpoint"`
+}
+
+type BridgeLog struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
 type DeviceEvent struct {
 	Data Data   `json:"data"`
 	Type string `json:"type"`
@@ -44,4 +87,5 @@ type DeviceEvent struct {
 type Data struct {
 	FriendlyName string `json:"friendly_name"`
 	IeeeAddress  string `json:"ieee_address"`
+	Status       string `json:"status"`
 }
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/creasty/defaults v1.7.0
+	github.com/eclipse/paho.golang v0.11.0
 	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/nicksnyder/go-i18n/v2 v2.2.1
 	github.com/weekaung/sparkplugb-client v0.0.0-20230609021422-1da7995486d7
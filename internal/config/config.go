@@ -43,6 +43,11 @@ func Init() {
 	if err != nil {
 		log.Fatalf("Could not read config: %v", err)
 	}
+	for i := range config.ZoneRules {
+		if err := config.ZoneRules[i].Compile(); err != nil {
+			log.Fatalf("Invalid zone rule %d: %v", i+1, err)
+		}
+	}
 
 	instance = &config
 }
@@ -59,6 +64,10 @@ func Persons() []Person {
 	return instance.Persons
 }
 
+func ZoneRules() []ZoneRuleConfig {
+	return instance.ZoneRules
+}
+
 func Devices() []DeviceConfig {
 	return instance.Devices
 }
@@ -75,6 +84,10 @@ func HomeAssistant() []HomeAssistantConfig {
 	return instance.HomeAssistant
 }
 
+func HassPanel() *HassPanelConfig {
+	return instance.HassPanel
+}
+
 func WhatsApp() *WhatsAppConfiguration {
 	return instance.WhatsApp
 }
@@ -82,3 +95,19 @@ func WhatsApp() *WhatsAppConfiguration {
 func Notification() []string {
 	return instance.Notification
 }
+
+func Supervision() SupervisionConfig {
+	return instance.Supervision
+}
+
+func Fire() FireConfig {
+	return instance.Fire
+}
+
+func Debounce() []DebounceConfig {
+	return instance.Debounce
+}
+
+func VirtualDevices() []VirtualDeviceConfig {
+	return instance.Virtual
+}
@@ -1,15 +1,23 @@
 package config
 
+import "regexp"
+
 type Config struct {
 	General       GeneralConfig          `yaml:"general"`
 	Log           LogConfig              `yaml:"log"`
 	Persons       []Person               `yaml:"persons"`
 	Devices       []DeviceConfig         `yaml:"devices"`
 	Zones         []ZoneConfig           `yaml:"zones"`
+	ZoneRules     []ZoneRuleConfig       `yaml:"zoneRules"`
 	Zigbee2Mqtt   []Zigbee2MqttConfig    `yaml:"zigbee2mqtt"`
 	HomeAssistant []HomeAssistantConfig  `yaml:"homeassistant"`
+	HassPanel     *HassPanelConfig       `yaml:"homeassistantPanel"`
 	WhatsApp      *WhatsAppConfiguration `yaml:"whatsapp"`
 	Notification  []string               `yaml:"notifications"`
+	Supervision   SupervisionConfig      `yaml:"supervision"`
+	Fire          FireConfig             `yaml:"fire"`
+	Debounce      []DebounceConfig       `yaml:"debounce"`
+	Virtual       []VirtualDeviceConfig  `yaml:"virtualDevices"`
 }
 
 type GeneralConfig struct {
@@ -23,6 +31,12 @@ type GeneralConfig struct {
 	TamperAlarmWhileDisarmed    bool    `yaml:"tamperAlarmWhileDisarmed" default:"false"`
 	DeviceSystemFaultAlarm      bool    `yaml:"deviceSystemFaultAlarm" default:"true"`
 	DeviceSystemFaultAlarmDelay int     `yaml:"deviceSystemFaultAlarmDelay" default:"300"`
+	SilenceBeforeDisarm         bool    `yaml:"silenceBeforeDisarm" default:"false"`
+	WalkTestTimeout             int     `yaml:"walkTestTimeout" default:"900"`
+	MaintenanceTimeout          int     `yaml:"maintenanceTimeout" default:"3600"`
+	// ArmBlockingTroubles lists the trouble types that block arming until acknowledged, nil means the
+	// troubles affecting detection.
+	ArmBlockingTroubles []string `yaml:"armBlockingTroubles"`
 }
 
 type LogConfig struct {
@@ -30,6 +44,55 @@ type LogConfig struct {
 	Format string `yaml:"format" default:"text"`
 }
 
+type SupervisionConfig struct {
+	CheckInterval int            `yaml:"checkInterval" default:"60"`
+	Windows       map[string]int `yaml:"windows"`
+}
+
+type FireConfig struct {
+	Verification       bool `yaml:"verification" default:"false"`
+	VerificationTime   int  `yaml:"verificationTime" default:"30"`
+	VerificationWindow int  `yaml:"verificationWindow" default:"120"`
+}
+
+// DebounceConfig configures debouncing per sensor type or device. StableTimeMs is given in milliseconds to allow
+// short contact bounces, the intervals in seconds.
+type DebounceConfig struct {
+	Device            string `yaml:"device"`
+	Sensor            string `yaml:"sensor"`
+	StableTimeMs      int    `yaml:"stableTimeMs"`
+	MinNotifyInterval int    `yaml:"minNotifyInterval"`
+	TriggerCount      int    `yaml:"triggerCount"`
+	TriggerWindow     int    `yaml:"triggerWindow"`
+}
+
+type VirtualDeviceConfig struct {
+	Id     string               `yaml:"id"`
+	Name   string               `yaml:"name"`
+	Zone   string               `yaml:"zone"`
+	Sensor string               `yaml:"sensor"`
+	Logic  string               `yaml:"logic"`
+	Count  int                  `yaml:"count"`
+	Window int                  `yaml:"window"`
+	Inputs []VirtualInputConfig `yaml:"inputs"`
+}
+
+type VirtualInputConfig struct {
+	Device string `yaml:"device"`
+	Sensor string `yaml:"sensor"`
+}
+
+type ZoneRuleConfig struct {
+	Zone        string `yaml:"zone"`
+	Connector   string `yaml:"connector"`
+	Name        string `yaml:"name"`
+	Regex       string `yaml:"regex"`
+	IeeeAddress string `yaml:"ieeeAddress"`
+	Area        string `yaml:"area"`
+
+	regex *regexp.Regexp
+}
+
 type DeviceConfig struct {
 	Id   string `yaml:"id"`
 	Zone string `yaml:"zone"`
@@ -42,12 +105,109 @@ type Zigbee2MqttConfig struct {
 	Username  string `yaml:"username"`
 	Password  string `yaml:"password"`
 	BaseTopic string `yaml:"baseTopic"`
+	// Url may use the schemes tcp/mqtt, ssl/tls/mqtts, ws and wss
+	Tls *TlsConfig `yaml:"tls"`
+	// ProtocolVersion is 3 (MQTT 3.1), 4 (MQTT 3.1.1) or 5 (MQTT 5, without websockets), default is 3.1.1
+	ProtocolVersion int `yaml:"protocolVersion"`
+
+	AvailabilityGracePeriod int `yaml:"availabilityGracePeriod"`
+
+	Groups  *Zigbee2MqttGroupsConfig `yaml:"groups"`
+	Sirens  []SirenProfileConfig     `yaml:"sirens"`
+	Keypads []KeypadProfileConfig    `yaml:"keypads"`
+}
+
+// KeypadProfileConfig configures the keypads of a device model or of a single device (friendly name).
+type KeypadProfileConfig struct {
+	Model      string            `yaml:"model"`
+	Device     string            `yaml:"device"`
+	RequirePin bool              `yaml:"requirePin"`
+	ArmMode    string            `yaml:"armMode"`
+	Actions    map[string]string `yaml:"actions"`
+}
+
+// Zigbee2MqttGroupsConfig names the groups used to control all sirens or all keypads with a single message.
+type Zigbee2MqttGroupsConfig struct {
+	Sirens     string `yaml:"sirens"`
+	Keypads    string `yaml:"keypads"`
+	AutoCreate bool   `yaml:"autoCreate"`
+}
+
+// SirenProfileConfig configures the sirens of a device model or of a single device (friendly name).
+type SirenProfileConfig struct {
+	Model             string                   `yaml:"model"`
+	Device            string                   `yaml:"device"`
+	Resend            bool                     `yaml:"resend"`
+	Alarms            map[string]WarningConfig `yaml:"alarms"`
+	NotificationShort *WarningConfig           `yaml:"notificationShort"`
+	NotificationLong  *WarningConfig           `yaml:"notificationLong"`
+	Squawk            *SquawkConfig            `yaml:"squawk"`
+}
+
+type WarningConfig struct {
+	Mode            string `yaml:"mode"`
+	Level           string `yaml:"level"`
+	Strobe          bool   `yaml:"strobe"`
+	StrobeLevel     string `yaml:"strobeLevel"`
+	StrobeDutyCycle int    `yaml:"strobeDutyCycle"`
+	Duration        int    `yaml:"duration"`
+}
+
+type SquawkConfig struct {
+	Arm    bool   `yaml:"arm"`
+	Disarm bool   `yaml:"disarm"`
+	Level  string `yaml:"level"`
+	Strobe bool   `yaml:"strobe"`
 }
 
 type HomeAssistantConfig struct {
 	Id    string `yaml:"id"`
 	Url   string `yaml:"url"`
 	Token string `yaml:"token"`
+
+	Actors  []HomeAssistantActorConfig  `yaml:"actors"`
+	Keypads []HomeAssistantKeypadConfig `yaml:"keypads"`
+}
+
+// HomeAssistantKeypadConfig maps the events of a keypad integration (e.g. zha_event) and alarm panel entities to
+// arming and disarming. Actions are looked up in the event data fields ActionFields, the first field found wins.
+type HomeAssistantKeypadConfig struct {
+	Name         string            `yaml:"name"`
+	Event        string            `yaml:"event"`
+	ActionFields []string          `yaml:"actionFields"`
+	CodeField    string            `yaml:"codeField"`
+	RequirePin   bool              `yaml:"requirePin"`
+	Actions      map[string]string `yaml:"actions"`
+	Entities     []string          `yaml:"entities"`
+	Code         string            `yaml:"code"`
+}
+
+// HassPanelConfig configures the MQTT broker used to publish Waechter as alarm panel to Home Assistant.
+type HassPanelConfig struct {
+	Url             string     `yaml:"url"`
+	ClientId        string     `yaml:"clientId"`
+	Username        string     `yaml:"username"`
+	Password        string     `yaml:"password"`
+	Tls             *TlsConfig `yaml:"tls"`
+	BaseTopic       string     `yaml:"baseTopic"`
+	DiscoveryPrefix string     `yaml:"discoveryPrefix"`
+	// BypassCode is the PIN used for the bypass switches, without it the bypasses are shown read-only. It is sent
+	// with every switch change, so anybody who can publish to the switch topics can bypass zones. The BYPASS and
+	// UNBYPASS panel commands carry the code entered by the user instead.
+	BypassCode string `yaml:"bypassCode"`
+}
+
+// HomeAssistantActorConfig configures an entity (siren, light or switch) or a notify service (Service) that is
+// controlled on alarm. Sirens are discovered without configuration, an entry only changes their settings.
+type HomeAssistantActorConfig struct {
+	Entity      string  `yaml:"entity"`
+	Service     string  `yaml:"service"`
+	Name        string  `yaml:"name"`
+	Tone        string  `yaml:"tone"`
+	VolumeLevel float32 `yaml:"volumeLevel"`
+	Duration    int     `yaml:"duration"`
+	Flash       string  `yaml:"flash"`
+	Lang        string  `yaml:"lang"`
 }
 
 type ZoneConfig struct {
@@ -62,6 +222,7 @@ type Person struct {
 	Pin      string `yaml:"pin"`
 	Lang     string `yaml:"lang"`
 	WhatsApp string `yaml:"whatsapp"`
+	Admin    bool   `yaml:"admin"`
 }
 
 type WhatsAppConfiguration struct {
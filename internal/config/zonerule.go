@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Compile validates the name pattern of the rule and compiles its regular expression once when the configuration
+// is loaded.
+func (r *ZoneRuleConfig) Compile() error {
+	if r.Name != "" {
+		if _, err := path.Match(r.Name, ""); err != nil {
+			return fmt.Errorf("name %q: %w", r.Name, err)
+		}
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("regex %q: %w", r.Regex, err)
+		}
+		r.regex = re
+	}
+	return nil
+}
+
+// CompiledRegex returns the regular expression compiled by Compile, nil if the rule has none.
+func (r ZoneRuleConfig) CompiledRegex() *regexp.Regexp {
+	return r.regex
+}
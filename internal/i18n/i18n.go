@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/mtrossbach/waechter/internal/log"
 	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"golang.org/x/text/language"
 	"os"
@@ -78,6 +79,36 @@ func TranslateAlarm(lang string, alarmType alarm.Type) string {
 		return Translate(lang, AlarmTamper)
 	case alarm.TamperPin:
 		return Translate(lang, AlarmTamperPin)
+	case alarm.FireVerification:
+		return Translate(lang, AlarmFireVerification)
 	}
 	return string(alarmType)
 }
+
+func TranslateTrouble(lang string, troubleType trouble.Type) string {
+	switch troubleType {
+	case trouble.LowBattery:
+		return Translate(lang, TroubleLowBattery)
+	case trouble.PoorSignal:
+		return Translate(lang, TroublePoorSignal)
+	case trouble.SupervisionLoss:
+		return Translate(lang, TroubleSupervisionLoss)
+	case trouble.ConnectorOffline:
+		return Translate(lang, TroubleConnectorOffline)
+	case trouble.NotificationFailure:
+		return Translate(lang, TroubleNotificationFailure)
+	case trouble.PersistenceFailure:
+		return Translate(lang, TroublePersistenceFailure)
+	case trouble.Clock:
+		return Translate(lang, TroubleClock)
+	case trouble.UnassignedDevice:
+		return Translate(lang, TroubleUnassignedDevice)
+	case trouble.DeviceMissing:
+		return Translate(lang, TroubleDeviceMissing)
+	case trouble.DeviceSubstitution:
+		return Translate(lang, TroubleDeviceSubstitution)
+	case trouble.ActorFailure:
+		return Translate(lang, TroubleActorFailure)
+	}
+	return string(troubleType)
+}
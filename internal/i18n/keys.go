@@ -3,8 +3,25 @@ package i18n
 type Key string
 
 const (
-	WALowBattery     Key = "whatsapp_low_battery"
-	WALowLinkQuality Key = "whatsapp_low_link_quality"
+	WATroubleCleared Key = "whatsapp_trouble_cleared"
+	WAAlarmMemory    Key = "whatsapp_alarm_memory"
+	WAWalkTestReport Key = "whatsapp_walk_test_report"
+
+	WAMaintenanceEnded       Key = "whatsapp_maintenance_ended"
+	WADiscoveredWhileOffline Key = "whatsapp_discovered_while_offline"
+	WADeviceJoined           Key = "whatsapp_device_joined"
+
+	TroubleLowBattery          Key = "trouble_low_battery"
+	TroublePoorSignal          Key = "trouble_poor_signal"
+	TroubleSupervisionLoss     Key = "trouble_supervision_loss"
+	TroubleConnectorOffline    Key = "trouble_connector_offline"
+	TroubleNotificationFailure Key = "trouble_notification_failure"
+	TroublePersistenceFailure  Key = "trouble_persistence_failure"
+	TroubleClock               Key = "trouble_clock"
+	TroubleUnassignedDevice    Key = "trouble_unassigned_device"
+	TroubleDeviceMissing       Key = "trouble_device_missing"
+	TroubleDeviceSubstitution  Key = "trouble_device_substitution"
+	TroubleActorFailure        Key = "trouble_actor_failure"
 
 	AlarmNone       Key = "alarm_none"
 	AlarmEntryDelay Key = "alarm_entry_delay"
@@ -13,4 +30,6 @@ const (
 	AlarmFire       Key = "alarm_fire"
 	AlarmTamper     Key = "alarm_tamper"
 	AlarmTamperPin  Key = "alarm_tamper_pin"
+
+	AlarmFireVerification Key = "alarm_fire_verification"
 )
@@ -0,0 +1,106 @@
+package hasspanel
+
+import (
+	"fmt"
+	"github.com/mtrossbach/waechter/internal/config"
+)
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueId            string          `json:"unique_id"`
+	ObjectId            string          `json:"object_id"`
+	Device              discoveryDevice `json:"device"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	StateTopic          string          `json:"state_topic"`
+	CommandTopic        string          `json:"command_topic,omitempty"`
+	CommandTemplate     string          `json:"command_template,omitempty"`
+	JsonAttributesTopic string          `json:"json_attributes_topic,omitempty"`
+	DeviceClass         string          `json:"device_class,omitempty"`
+	EntityCategory      string          `json:"entity_category,omitempty"`
+	Icon                string          `json:"icon,omitempty"`
+
+	// alarm_control_panel only
+	Code               string   `json:"code,omitempty"`
+	CodeArmRequired    *bool    `json:"code_arm_required,omitempty"`
+	CodeDisarmRequired *bool    `json:"code_disarm_required,omitempty"`
+	SupportedFeatures  []string `json:"supported_features,omitempty"`
+}
+
+func (p *Panel) nodeId() string {
+	return objectIdFor(p.conf.BaseTopic)
+}
+
+func (p *Panel) entityConfig(name string, objectId string, stateTopic string) discoveryConfig {
+	return discoveryConfig{
+		Name:     name,
+		UniqueId: fmt.Sprintf("%s_%s", p.nodeId(), objectId),
+		ObjectId: fmt.Sprintf("%s_%s", p.nodeId(), objectId),
+		Device: discoveryDevice{
+			Identifiers:  []string{p.nodeId()},
+			Name:         config.General().Name,
+			Manufacturer: "Wächter",
+			Model:        "Wächter",
+		},
+		AvailabilityTopic: p.topic("availability"),
+		StateTopic:        stateTopic,
+	}
+}
+
+func (p *Panel) discoveryTopic(component string, objectId string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", p.conf.DiscoveryPrefix, component, p.nodeId(), objectId)
+}
+
+// publishDiscovery announces all entities. The code is validated by Waechter, Home Assistant only passes it on.
+func (p *Panel) publishDiscovery() {
+	required := true
+	c := p.entityConfig("Alarm panel", "panel", p.topic("state"))
+	c.CommandTopic = p.topic("set")
+	c.CommandTemplate = `{"action":"{{ action }}","code":"{{ code }}"}`
+	c.Code = "REMOTE_CODE"
+	c.CodeArmRequired = &required
+	c.CodeDisarmRequired = &required
+	c.SupportedFeatures = []string{"arm_home", "arm_away"}
+	p.announce(p.discoveryTopic("alarm_control_panel", "panel"), c)
+
+	for _, z := range p.ctrl.ZoneStatuses() {
+		objectId := objectIdFor(string(z.Zone.Id))
+		name := z.Zone.DisplayName
+		if len(name) == 0 {
+			name = string(z.Zone.Id)
+		}
+
+		c := p.entityConfig(name, "zone_"+objectId, p.topic("zone/"+objectId+"/state"))
+		c.DeviceClass = "safety"
+		p.announce(p.discoveryTopic("binary_sensor", "zone_"+objectId), c)
+
+		// without bypass code the bypass is shown as binary sensor, as a switch cannot pass a code
+		c = p.entityConfig(name+" bypass", "bypass_"+objectId, p.topic("zone/"+objectId+"/bypass"))
+		c.Icon = "mdi:shield-off"
+		if len(p.conf.BypassCode) > 0 {
+			c.EntityCategory = "config"
+			c.CommandTopic = p.topic("zone/" + objectId + "/bypass/set")
+			p.retract(p.discoveryTopic("binary_sensor", "bypass_"+objectId))
+			p.announce(p.discoveryTopic("switch", "bypass_"+objectId), c)
+		} else {
+			c.EntityCategory = "diagnostic"
+			p.retract(p.discoveryTopic("switch", "bypass_"+objectId))
+			p.announce(p.discoveryTopic("binary_sensor", "bypass_"+objectId), c)
+		}
+	}
+
+	for _, t := range troubleTypes {
+		objectId := objectIdFor(string(t))
+		c := p.entityConfig("Trouble "+string(t), "trouble_"+objectId, p.topic("trouble/"+objectId+"/state"))
+		c.DeviceClass = "problem"
+		c.EntityCategory = "diagnostic"
+		c.JsonAttributesTopic = p.topic("trouble/" + objectId + "/attributes")
+		p.announce(p.discoveryTopic("binary_sensor", "trouble_"+objectId), c)
+	}
+}
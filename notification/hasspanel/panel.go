@@ -0,0 +1,228 @@
+package hasspanel
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/zone"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	online  = "online"
+	offline = "offline"
+
+	refreshInterval      = 1 * time.Second
+	maxReconnectInterval = 2 * time.Minute
+)
+
+// Panel publishes Waechter as alarm_control_panel to Home Assistant via MQTT discovery, together with a binary
+// sensor per zone and per trouble type and a bypass switch per zone.
+type Panel struct {
+	conf   config.HassPanelConfig
+	ctrl   system.Controller
+	client mqtt.Client
+
+	mutex     sync.Mutex
+	published map[string]string
+}
+
+type command struct {
+	Action string  `json:"action"`
+	Code   string  `json:"code"`
+	Zone   zone.Id `json:"zone"`
+}
+
+func NewPanel(configuration config.HassPanelConfig, controller system.Controller) *Panel {
+	if len(configuration.BaseTopic) == 0 {
+		configuration.BaseTopic = "waechter"
+	}
+	if len(configuration.DiscoveryPrefix) == 0 {
+		configuration.DiscoveryPrefix = "homeassistant"
+	}
+	if len(configuration.ClientId) == 0 {
+		hostname, _ := os.Hostname()
+		suffix := make([]byte, 3)
+		_, _ = crand.Read(suffix)
+		configuration.ClientId = fmt.Sprintf("waechter-panel-%s-%x", hostname, suffix)
+	}
+	return &Panel{
+		conf:      configuration,
+		ctrl:      controller,
+		published: map[string]string{},
+	}
+}
+
+// Start connects to the broker, it fails if the TLS configuration cannot be loaded.
+func (p *Panel) Start() error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(p.conf.Url)
+	opts.SetClientID(p.conf.ClientId)
+	opts.SetUsername(p.conf.Username)
+	opts.SetPassword(p.conf.Password)
+	if p.conf.Tls != nil {
+		tlsConfig, err := p.conf.Tls.Load()
+		if err != nil {
+			return fmt.Errorf("could not load TLS configuration: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetWill(p.topic("availability"), offline, 1, true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetMaxReconnectInterval(maxReconnectInterval)
+	opts.OnConnect = p.onConnect
+	opts.OnConnectionLost = func(client mqtt.Client, err error) {
+		log.Error().Err(err).Str("url", p.conf.Url).Msg("Connection to Home Assistant panel broker lost. Reconnecting ...")
+	}
+
+	p.client = mqtt.NewClient(opts)
+	p.client.Connect()
+	go p.refresh()
+	return nil
+}
+
+func (p *Panel) onConnect(client mqtt.Client) {
+	log.Info().Str("url", p.conf.Url).Msg("Connected to Home Assistant panel broker")
+
+	p.mutex.Lock()
+	p.published = map[string]string{}
+	p.mutex.Unlock()
+
+	client.Subscribe(p.topic("set"), 1, p.handleCommand)
+	if len(p.conf.BypassCode) > 0 {
+		client.Subscribe(p.topic("zone/+/bypass/set"), 1, p.handleBypass)
+	}
+	// Home Assistant announces restarts on its status topic, discovery has to be sent again then
+	client.Subscribe(fmt.Sprintf("%s/status", p.conf.DiscoveryPrefix), 1, func(_ mqtt.Client, msg mqtt.Message) {
+		if string(msg.Payload()) == online {
+			p.publishDiscovery()
+		}
+	})
+
+	p.publishDiscovery()
+	p.publish(p.topic("availability"), online)
+	p.publishState()
+}
+
+func (p *Panel) topic(suffix string) string {
+	return fmt.Sprintf("%s/%s", p.conf.BaseTopic, suffix)
+}
+
+// publish sends a retained value, unchanged values are only sent once per connection.
+func (p *Panel) publish(topic string, value string) {
+	p.mutex.Lock()
+	if last, ok := p.published[topic]; ok && last == value {
+		p.mutex.Unlock()
+		return
+	}
+	p.published[topic] = value
+	p.mutex.Unlock()
+
+	p.client.Publish(topic, 1, true, value)
+	log.Debug().Str("topic", topic).Str("value", value).Msg("Published panel state")
+}
+
+func (p *Panel) publishJson(topic string, payload any) {
+	if data, err := json.Marshal(payload); err != nil {
+		log.Error().Err(err).Str("topic", topic).Msg("Could not marshal panel payload")
+	} else {
+		p.publish(topic, string(data))
+	}
+}
+
+// retract removes an entity announced before.
+func (p *Panel) retract(topic string) {
+	p.client.Publish(topic, 1, true, "")
+}
+
+// announce sends a discovery config, which is always sent again after a restart of Home Assistant.
+func (p *Panel) announce(topic string, payload any) {
+	if data, err := json.Marshal(payload); err != nil {
+		log.Error().Err(err).Str("topic", topic).Msg("Could not marshal discovery payload")
+	} else {
+		p.client.Publish(topic, 1, true, data)
+	}
+}
+
+func (p *Panel) refresh() {
+	for range time.Tick(refreshInterval) {
+		if p.client.IsConnectionOpen() {
+			p.publishState()
+		}
+	}
+}
+
+// handleCommand executes the commands of the alarm panel. SILENCE, RESET, BYPASS and UNBYPASS are not sent by the
+// panel itself, but can be published by automations and scripts, e.g. for actionable notifications of the Home
+// Assistant app. Unlike the bypass switches, BYPASS and UNBYPASS carry the code entered by the user.
+func (p *Panel) handleCommand(_ mqtt.Client, msg mqtt.Message) {
+	var cmd command
+	if err := json.Unmarshal(msg.Payload(), &cmd); err != nil {
+		log.Error().Err(err).Str("payload", string(msg.Payload())).Msg("Could not parse panel command")
+		return
+	}
+
+	var ok bool
+	switch cmd.Action {
+	case "ARM_HOME":
+		ok = p.ctrl.Arm(cmd.Code, arm.Perimeter)
+	case "ARM_AWAY":
+		ok = p.ctrl.Arm(cmd.Code, arm.All)
+	case "DISARM":
+		ok = p.ctrl.Disarm(cmd.Code)
+	case "SILENCE":
+		ok = p.ctrl.SilenceAlarm(cmd.Code)
+	case "RESET":
+		ok = p.ctrl.ResetAlarm(cmd.Code)
+	case "BYPASS":
+		ok = p.ctrl.BypassZone(cmd.Code, cmd.Zone, true)
+	case "UNBYPASS":
+		ok = p.ctrl.BypassZone(cmd.Code, cmd.Zone, false)
+	default:
+		log.Warn().Str("action", cmd.Action).Msg("Unknown panel command")
+		return
+	}
+	log.Info().Str("action", cmd.Action).Bool("ok", ok).Msg("Panel command from Home Assistant")
+	p.publishState()
+}
+
+func (p *Panel) handleBypass(_ mqtt.Client, msg mqtt.Message) {
+	parts := strings.Split(strings.TrimPrefix(msg.Topic(), p.topic("zone/")), "/")
+	id := p.zoneForObjectId(parts[0])
+	if id == nil {
+		log.Warn().Str("topic", msg.Topic()).Msg("Bypass for unknown zone")
+		return
+	}
+	// switches cannot pass a code, so the configured bypass code is used: anybody who can publish to the topic can
+	// bypass zones
+	p.ctrl.BypassZone(p.conf.BypassCode, *id, string(msg.Payload()) == "ON")
+	p.publishState()
+}
+
+func (p *Panel) zoneForObjectId(objectId string) *zone.Id {
+	for _, z := range p.ctrl.ZoneStatuses() {
+		if objectIdFor(string(z.Zone.Id)) == objectId {
+			return &z.Zone.Id
+		}
+	}
+	return nil
+}
+
+// objectIdFor makes ids usable in topics and entity ids.
+func objectIdFor(id string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+}
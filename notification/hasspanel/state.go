@@ -0,0 +1,74 @@
+package hasspanel
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"time"
+)
+
+// troubleTypes are published as problem sensors, even while they are not raised.
+var troubleTypes = []trouble.Type{
+	trouble.LowBattery,
+	trouble.PoorSignal,
+	trouble.SupervisionLoss,
+	trouble.ConnectorOffline,
+	trouble.NotificationFailure,
+	trouble.PersistenceFailure,
+	trouble.Clock,
+	trouble.UnassignedDevice,
+	trouble.DeviceMissing,
+	trouble.DeviceSubstitution,
+	trouble.ActorFailure,
+}
+
+// panelState maps the system state to the states of a Home Assistant alarm_control_panel.
+func panelState(state system.State) string {
+	if state.Alarm.IsPending() {
+		return "pending"
+	}
+	if state.Alarm != alarm.None {
+		return "triggered"
+	}
+	if state.Armed() && time.Now().Sub(state.ArmModeUpdated) < time.Duration(config.General().ExitDelay)*time.Second {
+		return "arming"
+	}
+	switch state.ArmMode {
+	case arm.Perimeter:
+		return "armed_home"
+	case arm.All:
+		return "armed_away"
+	}
+	return "disarmed"
+}
+
+func onOff(value bool) string {
+	if value {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func (p *Panel) publishState() {
+	p.publish(p.topic("state"), panelState(p.ctrl.SystemState()))
+
+	for _, z := range p.ctrl.ZoneStatuses() {
+		objectId := objectIdFor(string(z.Zone.Id))
+		p.publish(p.topic("zone/"+objectId+"/state"), onOff(z.Triggered))
+		p.publish(p.topic("zone/"+objectId+"/bypass"), onOff(z.Zone.Bypassed))
+	}
+
+	sources := map[trouble.Type][]string{}
+	for _, t := range p.ctrl.Troubles() {
+		if t.Open() {
+			sources[t.Type] = append(sources[t.Type], t.Source)
+		}
+	}
+	for _, t := range troubleTypes {
+		objectId := objectIdFor(string(t))
+		p.publish(p.topic("trouble/"+objectId+"/state"), onOff(len(sources[t]) > 0))
+		p.publishJson(p.topic("trouble/"+objectId+"/attributes"), map[string]any{"sources": sources[t]})
+	}
+}
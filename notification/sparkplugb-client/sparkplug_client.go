@@ -15,6 +15,7 @@ package sparkplugb_client
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -23,6 +24,7 @@ import (
 	"github.com/mtrossbach/waechter/system"
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/mtrossbach/waechter/system/zone"
 	"net"
 	"strconv"
@@ -152,6 +154,46 @@ func (s *Sparkplug) NotifySmokeSensor(person config.Person, systemName string, d
 	return true
 }
 
+func (s *Sparkplug) NotifyTrouble(person config.Person, systemName string, t trouble.Trouble, dev device.Spec, zone zone.Zone) bool {
+	publishJson("Trouble", t)
+	return true
+}
+
+func (s *Sparkplug) NotifyTroubleCleared(person config.Person, systemName string, t trouble.Trouble, dev device.Spec, zone zone.Zone) bool {
+	publishJson("Trouble", t)
+	return true
+}
+
+func (s *Sparkplug) NotifyAlarmMemory(person config.Person, systemName string, entries []system.AlarmMemoryEntry) bool {
+	// Publish the entries of the arming period that just ended
+	publishJson("Alarm Memory", entries)
+	return true
+}
+
+func (s *Sparkplug) NotifyWalkTestReport(person config.Person, systemName string, report system.WalkTestReport) bool {
+	publishJson("Walk Test Report", report)
+	return true
+}
+
+func (s *Sparkplug) NotifyMaintenanceEnded(person config.Person, systemName string, tampered []device.Spec) bool {
+	ids := []device.Id{}
+	for _, d := range tampered {
+		ids = append(ids, d.Id)
+	}
+	publishJson("Maintenance Ended", deviceEvent{Tampered: ids})
+	return true
+}
+
+func (s *Sparkplug) NotifyDiscoveredWhileOffline(person config.Person, systemName string, dev device.Spec, zone zone.Zone, sensor device.Sensor) bool {
+	publishJson("Discovered While Offline", deviceEvent{Device: dev.Id, IeeeAddress: dev.IeeeAddress, Zone: zone.Id, Sensor: sensor})
+	return true
+}
+
+func (s *Sparkplug) NotifyDeviceJoined(person config.Person, systemName string, dev device.Spec, zone zone.Zone) bool {
+	publishJson("Device Joined", deviceEvent{Device: dev.Id, IeeeAddress: dev.IeeeAddress, Zone: zone.Id})
+	return true
+}
+
 func (s *Sparkplug) NotifyAutoArm(person config.Person, systemName string) bool {
 	return true
 }
@@ -169,6 +211,95 @@ func (s *Sparkplug) NotifyAutoDisarm(person config.Person, systemName string) bo
 var sysController system.Controller
 var sp Sparkplug
 
+// deviceEvent is published as JSON for events that concern devices but are not device data.
+type deviceEvent struct {
+	Device      device.Id     `json:"device,omitempty"`
+	IeeeAddress string        `json:"ieeeAddress,omitempty"`
+	Zone        zone.Id       `json:"zone,omitempty"`
+	Sensor      device.Sensor `json:"sensor,omitempty"`
+	Tampered    []device.Id   `json:"tampered,omitempty"`
+}
+
+// maintenanceRequest is the value of the "Node Control/Start Device Maintenance" metric.
+type maintenanceRequest struct {
+	Pin     string      `json:"pin"`
+	Devices []device.Id `json:"devices"`
+}
+
+// registryUpdate is the value of the "Node Control/Update Device Registry" metric.
+type registryUpdate struct {
+	Pin         string    `json:"pin"`
+	Id          device.Id `json:"id"`
+	DisplayName string    `json:"displayName"`
+	Enabled     bool      `json:"enabled"`
+}
+
+// pairingRequest is the value of the "Node Control/Start Pairing" metric, the duration is given in seconds.
+type pairingRequest struct {
+	Pin       string `json:"pin"`
+	Connector string `json:"connector"`
+	Duration  int    `json:"duration"`
+}
+
+// deviceAssignment is the value of the "Node Control/Assign Device" and "Node Control/Remove Device" metrics.
+type deviceAssignment struct {
+	Pin  string    `json:"pin"`
+	Id   device.Id `json:"id"`
+	Name string    `json:"name"`
+	Zone zone.Id   `json:"zone"`
+}
+
+// handlePairingControl executes the pairing metrics and returns true if the pairing status has to be published.
+func handlePairingControl(m sparkplug.Metric) bool {
+	if m.Name == "Node Control/Pairing Status" && m.DataType == sparkplug.TypeBool && m.Value == "true" {
+		return true
+	}
+	if m.DataType != sparkplug.TypeString {
+		return false
+	}
+	switch m.Name {
+	case "Node Control/Start Pairing":
+		// value is a JSON object with the PIN of an admin, the connector id and the duration
+		var r pairingRequest
+		if err := json.Unmarshal([]byte(m.Value), &r); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		return sysController.StartPairing(r.Pin, r.Connector, r.Duration)
+	case "Node Control/Stop Pairing":
+		// value is the PIN of an admin
+		return sysController.StopPairing(m.Value)
+	}
+	return false
+}
+
+// handleDeviceAssignment executes the metrics naming, assigning and removing devices and returns true if the
+// device registry has to be published.
+func handleDeviceAssignment(m sparkplug.Metric) bool {
+	if m.DataType != sparkplug.TypeString {
+		return false
+	}
+	switch m.Name {
+	case "Node Control/Assign Device":
+		// value is a JSON object with the PIN of an admin, the device id, its new name (optional) and the zone
+		var a deviceAssignment
+		if err := json.Unmarshal([]byte(m.Value), &a); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		return sysController.AssignDevice(a.Pin, a.Id, a.Name, a.Zone)
+	case "Node Control/Remove Device":
+		// value is a JSON object with the PIN of an admin and the device id
+		var a deviceAssignment
+		if err := json.Unmarshal([]byte(m.Value), &a); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		return sysController.RemoveDevice(a.Pin, a.Id)
+	}
+	return false
+}
+
 func NewSparkplug(w system.Controller) *Sparkplug {
 	sysController = w
 
@@ -214,6 +345,24 @@ func sendingNodeBirth() {
 	}
 }
 
+// publishJson publishes a value as JSON encoded string metric of the node.
+func publishJson(name string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	ms := []sparkplug.Metric{{
+		Name:     name,
+		DataType: sparkplug.TypeString,
+		Value:    string(data),
+	}}
+	err = sp.node.PublishNodeData(ms)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
 func reconnectZigbee2Mqtt() {
 	sysController.DeviceConnectorForId("z2m").DisconnectForReconnect()
 }
@@ -250,6 +399,79 @@ var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Me
 			// reconnect Zigbee2Mqtt for sending devices list again
 			reconnectZigbee2Mqtt()
 		}
+		if ms[i].Name == "Node Control/Silence Alarm" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of the person silencing the alarm
+			sysController.SilenceAlarm(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Reset Alarm" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of the person resetting the alarm
+			sysController.ResetAlarm(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Clear Alarm Memory" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of the person clearing the alarm memory
+			sysController.ClearAlarmMemory(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Start Walk Test" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of an admin
+			sysController.StartWalkTest(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Stop Walk Test" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of an admin
+			sysController.StopWalkTest(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Start Maintenance" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of an admin, maintenance covers all devices
+			sysController.StartMaintenance(ms[i].Value, nil)
+		}
+		if ms[i].Name == "Node Control/Start Device Maintenance" && ms[i].DataType == sparkplug.TypeString {
+			// value is a JSON object with the PIN of an admin and the devices to maintain
+			var r maintenanceRequest
+			if err := json.Unmarshal([]byte(ms[i].Value), &r); err != nil {
+				fmt.Println(err)
+			} else {
+				sysController.StartMaintenance(r.Pin, r.Devices)
+			}
+		}
+		if ms[i].Name == "Node Control/Stop Maintenance" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of an admin
+			sysController.StopMaintenance(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Device Registry" && ms[i].DataType == sparkplug.TypeBool && ms[i].Value == "true" {
+			// publish all entries of the device registry
+			publishJson("Device Registry", sysController.DeviceRegistry())
+		}
+		if ms[i].Name == "Node Control/Update Device Registry" && ms[i].DataType == sparkplug.TypeString {
+			// value is a JSON object with the PIN of an admin, the device id, its display name and enabled state
+			var u registryUpdate
+			if err := json.Unmarshal([]byte(ms[i].Value), &u); err != nil {
+				fmt.Println(err)
+			} else if sysController.UpdateDeviceRegistry(u.Pin, u.Id, u.DisplayName, u.Enabled) {
+				publishJson("Device Registry", sysController.DeviceRegistry())
+			}
+		}
+		if ms[i].Name == "Node Control/Acknowledge Troubles" && ms[i].DataType == sparkplug.TypeString {
+			// value is the PIN of the person acknowledging the troubles
+			sysController.AcknowledgeTroubles(ms[i].Value)
+		}
+		if ms[i].Name == "Node Control/Alarm Memory" && ms[i].DataType == sparkplug.TypeBool && ms[i].Value == "true" {
+			// publish all entries of the alarm memory
+			publishJson("Alarm Memory", sysController.AlarmMemory())
+		}
+		if ms[i].Name == "Node Control/Walk Test Report" && ms[i].DataType == sparkplug.TypeBool && ms[i].Value == "true" {
+			// publish the report of the running or the last walk test
+			publishJson("Walk Test Report", sysController.WalkTestReport())
+		}
+		if ms[i].Name == "Node Control/Device Statuses" && ms[i].DataType == sparkplug.TypeBool && ms[i].Value == "true" {
+			// publish last seen and supervision state of all devices
+			publishJson("Device Statuses", sysController.DeviceStatuses())
+		}
+		if handlePairingControl(ms[i]) {
+			// publish the running pairing with its events, null if none is running
+			publishJson("Pairing Status", sysController.PairingStatus())
+		}
+		if handleDeviceAssignment(ms[i]) {
+			publishJson("Device Registry", sysController.DeviceRegistry())
+		}
 	}
 }
 
@@ -300,11 +522,125 @@ func getNodeBirthMetrics() []sparkplug.Metric {
 		DataType: sparkplug.TypeString,
 		Value:    "1.0.0",
 	}
+	m5 := sparkplug.Metric{
+		Name:     "Node Control/Silence Alarm",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m6 := sparkplug.Metric{
+		Name:     "Node Control/Reset Alarm",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m7 := sparkplug.Metric{
+		Name:     "Node Control/Clear Alarm Memory",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m8 := sparkplug.Metric{
+		Name:     "Node Control/Start Walk Test",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m9 := sparkplug.Metric{
+		Name:     "Node Control/Stop Walk Test",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m10 := sparkplug.Metric{
+		Name:     "Node Control/Start Maintenance",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m11 := sparkplug.Metric{
+		Name:     "Node Control/Stop Maintenance",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m12 := sparkplug.Metric{
+		Name:     "Node Control/Device Statuses",
+		DataType: sparkplug.TypeBool,
+		Value:    "false",
+	}
+	m13 := sparkplug.Metric{
+		Name:     "Node Control/Acknowledge Troubles",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m14 := sparkplug.Metric{
+		Name:     "Node Control/Alarm Memory",
+		DataType: sparkplug.TypeBool,
+		Value:    "false",
+	}
+	m15 := sparkplug.Metric{
+		Name:     "Node Control/Walk Test Report",
+		DataType: sparkplug.TypeBool,
+		Value:    "false",
+	}
+	m16 := sparkplug.Metric{
+		Name:     "Node Control/Start Device Maintenance",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m17 := sparkplug.Metric{
+		Name:     "Node Control/Device Registry",
+		DataType: sparkplug.TypeBool,
+		Value:    "false",
+	}
+	m18 := sparkplug.Metric{
+		Name:     "Node Control/Update Device Registry",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m19 := sparkplug.Metric{
+		Name:     "Node Control/Start Pairing",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m20 := sparkplug.Metric{
+		Name:     "Node Control/Stop Pairing",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m21 := sparkplug.Metric{
+		Name:     "Node Control/Pairing Status",
+		DataType: sparkplug.TypeBool,
+		Value:    "false",
+	}
+	m22 := sparkplug.Metric{
+		Name:     "Node Control/Assign Device",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
+	m23 := sparkplug.Metric{
+		Name:     "Node Control/Remove Device",
+		DataType: sparkplug.TypeString,
+		Value:    "",
+	}
 	ms := []sparkplug.Metric{}
 	ms = append(ms, m1)
 	ms = append(ms, m2)
 	ms = append(ms, m3)
 	ms = append(ms, m4)
+	ms = append(ms, m5)
+	ms = append(ms, m6)
+	ms = append(ms, m7)
+	ms = append(ms, m8)
+	ms = append(ms, m9)
+	ms = append(ms, m10)
+	ms = append(ms, m11)
+	ms = append(ms, m12)
+	ms = append(ms, m13)
+	ms = append(ms, m14)
+	ms = append(ms, m15)
+	ms = append(ms, m16)
+	ms = append(ms, m17)
+	ms = append(ms, m18)
+	ms = append(ms, m19)
+	ms = append(ms, m20)
+	ms = append(ms, m21)
+	ms = append(ms, m22)
+	ms = append(ms, m23)
 
 	return ms
 }
@@ -0,0 +1,131 @@
+package sparkplugb_client
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mtrossbach/waechter/notification/sparkplugb-client/sparkplug"
+	"github.com/mtrossbach/waechter/system"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+)
+
+// testController records the pairing calls, the other methods of the controller are not used.
+type testController struct {
+	system.Controller
+	calls []string
+	ok    bool
+}
+
+func (c *testController) StartPairing(pin string, connectorId string, duration int) bool {
+	c.calls = append(c.calls, fmt.Sprintf("start %s %s %d", pin, connectorId, duration))
+	return c.ok
+}
+
+func (c *testController) StopPairing(pin string) bool {
+	c.calls = append(c.calls, "stop "+pin)
+	return c.ok
+}
+
+func (c *testController) AssignDevice(pin string, id device.Id, name string, zone zone.Id) bool {
+	c.calls = append(c.calls, "assign "+pin+" "+string(id)+" "+name+" "+string(zone))
+	return c.ok
+}
+
+func (c *testController) RemoveDevice(pin string, id device.Id) bool {
+	c.calls = append(c.calls, "remove "+pin+" "+string(id))
+	return c.ok
+}
+
+func TestPairingMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		metric       sparkplug.Metric
+		ok           bool
+		wantCalls    []string
+		wantStatus   bool
+		wantRegistry bool
+	}{
+		{
+			name:       "start pairing",
+			metric:     sparkplug.Metric{Name: "Node Control/Start Pairing", DataType: sparkplug.TypeString, Value: `{"pin":"1111","connector":"z2m","duration":120}`},
+			ok:         true,
+			wantCalls:  []string{"start 1111 z2m 120"},
+			wantStatus: true,
+		},
+		{
+			name:      "refused start",
+			metric:    sparkplug.Metric{Name: "Node Control/Start Pairing", DataType: sparkplug.TypeString, Value: `{"pin":"0000","connector":"z2m","duration":120}`},
+			wantCalls: []string{"start 0000 z2m 120"},
+		},
+		{
+			name:   "invalid start request",
+			metric: sparkplug.Metric{Name: "Node Control/Start Pairing", DataType: sparkplug.TypeString, Value: `1111`},
+			ok:     true,
+		},
+		{
+			name:       "stop pairing",
+			metric:     sparkplug.Metric{Name: "Node Control/Stop Pairing", DataType: sparkplug.TypeString, Value: "1111"},
+			ok:         true,
+			wantCalls:  []string{"stop 1111"},
+			wantStatus: true,
+		},
+		{
+			name:       "pairing status",
+			metric:     sparkplug.Metric{Name: "Node Control/Pairing Status", DataType: sparkplug.TypeBool, Value: "true"},
+			wantStatus: true,
+		},
+		{
+			name:   "no pairing status",
+			metric: sparkplug.Metric{Name: "Node Control/Pairing Status", DataType: sparkplug.TypeBool, Value: "false"},
+		},
+		{
+			name:         "assign device",
+			metric:       sparkplug.Metric{Name: "Node Control/Assign Device", DataType: sparkplug.TypeString, Value: `{"pin":"1111","id":"z2m::0x00158d0001a2b3c4","name":"Hall Motion","zone":"lr"}`},
+			ok:           true,
+			wantCalls:    []string{"assign 1111 z2m::0x00158d0001a2b3c4 Hall Motion lr"},
+			wantRegistry: true,
+		},
+		{
+			name:         "remove device",
+			metric:       sparkplug.Metric{Name: "Node Control/Remove Device", DataType: sparkplug.TypeString, Value: `{"pin":"1111","id":"z2m::Hall Motion"}`},
+			ok:           true,
+			wantCalls:    []string{"remove 1111 z2m::Hall Motion"},
+			wantRegistry: true,
+		},
+		{
+			name:      "refused removal",
+			metric:    sparkplug.Metric{Name: "Node Control/Remove Device", DataType: sparkplug.TypeString, Value: `{"pin":"0000","id":"z2m::Hall Motion"}`},
+			wantCalls: []string{"remove 0000 z2m::Hall Motion"},
+		},
+		{
+			name:   "wrong data type",
+			metric: sparkplug.Metric{Name: "Node Control/Stop Pairing", DataType: sparkplug.TypeBool, Value: "true"},
+			ok:     true,
+		},
+		{
+			name:   "other metric",
+			metric: sparkplug.Metric{Name: "Node Control/Reset Alarm", DataType: sparkplug.TypeString, Value: "1111"},
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &testController{ok: tt.ok}
+			sysController = c
+			defer func() { sysController = nil }()
+
+			if got := handlePairingControl(tt.metric); got != tt.wantStatus {
+				t.Errorf("handlePairingControl() = %v, want %v", got, tt.wantStatus)
+			}
+			if got := handleDeviceAssignment(tt.metric); got != tt.wantRegistry {
+				t.Errorf("handleDeviceAssignment() = %v, want %v", got, tt.wantRegistry)
+			}
+			if !reflect.DeepEqual(c.calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", c.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/internal/i18n"
 	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system"
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/mtrossbach/waechter/system/zone"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -131,19 +134,13 @@ func (w *WhatsApp) NotifyRecovery(person config.Person, systemName string, devic
 }
 
 func (w *WhatsApp) NotifyBatteryLevel(person config.Person, systemName string, device device.Spec, zone zone.Zone, batteryLevel float32) bool {
-	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
-		systemName, device.HumanReadableName(), i18n.Translate(person.Lang, i18n.WALowBattery),
-	})
-
-	return err == nil
+	// low batteries are reported as trouble
+	return true
 }
 
 func (w *WhatsApp) NotifyLinkQuality(person config.Person, systemName string, device device.Spec, zone zone.Zone, quality float32) bool {
-	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
-		systemName, device.HumanReadableName(), i18n.Translate(person.Lang, i18n.WALowLinkQuality),
-	})
-
-	return err == nil
+	// poor link quality is reported as trouble
+	return true
 }
 
 func (s *WhatsApp) NotifyDeviceAvailable(person config.Person, systemName string, device device.Spec, zone zone.Zone) bool {
@@ -179,6 +176,80 @@ func (w *WhatsApp) NotifySmokeSensor(person config.Person, systemName string, de
 	return true
 }
 
+func (w *WhatsApp) NotifyTrouble(person config.Person, systemName string, t trouble.Trouble, device device.Spec, zone zone.Zone) bool {
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, device.HumanReadableName(), i18n.TranslateTrouble(person.Lang, t.Type),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyTroubleCleared(person config.Person, systemName string, t trouble.Trouble, device device.Spec, zone zone.Zone) bool {
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, device.HumanReadableName(), fmt.Sprintf(i18n.Translate(person.Lang, i18n.WATroubleCleared), i18n.TranslateTrouble(person.Lang, t.Type)),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyAlarmMemory(person config.Person, systemName string, entries []system.AlarmMemoryEntry) bool {
+	var devices []string
+	for _, e := range entries {
+		devices = append(devices, fmt.Sprintf("%v (%v, %v)", e.DeviceName, i18n.TranslateAlarm(person.Lang, e.Alarm), e.Time.Format("15:04:05")))
+	}
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, strings.Join(devices, ", "), i18n.Translate(person.Lang, i18n.WAAlarmMemory),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyWalkTestReport(person config.Person, systemName string, report system.WalkTestReport) bool {
+	missing := []string{"-"}
+	if len(report.Missing) > 0 {
+		missing = nil
+		for _, d := range report.Missing {
+			missing = append(missing, d.DisplayName)
+		}
+	}
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, strings.Join(missing, ", "), fmt.Sprintf(i18n.Translate(person.Lang, i18n.WAWalkTestReport), len(report.Reported), len(report.Missing)),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyMaintenanceEnded(person config.Person, systemName string, tampered []device.Spec) bool {
+	devices := []string{"-"}
+	if len(tampered) > 0 {
+		devices = nil
+		for _, d := range tampered {
+			devices = append(devices, d.HumanReadableName())
+		}
+	}
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, strings.Join(devices, ", "), fmt.Sprintf(i18n.Translate(person.Lang, i18n.WAMaintenanceEnded), len(tampered)),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyDiscoveredWhileOffline(person config.Person, systemName string, device device.Spec, zone zone.Zone, sensor device.Sensor) bool {
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, device.HumanReadableName(), fmt.Sprintf(i18n.Translate(person.Lang, i18n.WADiscoveredWhileOffline), sensor),
+	})
+
+	return err == nil
+}
+
+func (w *WhatsApp) NotifyDeviceJoined(person config.Person, systemName string, device device.Spec, zone zone.Zone) bool {
+	err := w.send(person.WhatsApp, w.config.TemplateNotification, person.Lang, []string{
+		systemName, device.HumanReadableName(), i18n.Translate(person.Lang, i18n.WADeviceJoined),
+	})
+
+	return err == nil
+}
+
 func (w *WhatsApp) NotifyAutoArm(person config.Person, systemName string) bool {
 	err := w.send(person.WhatsApp, w.config.TemplateAutoArm, person.Lang, []string{
 		systemName,
@@ -3,15 +3,21 @@ package alarm
 type Type string
 
 const (
-	None       Type = "none"
-	EntryDelay Type = "entry-delay"
-	Burglar    Type = "burglar"
-	Panic      Type = "panic"
-	Fire       Type = "fire"
-	Tamper     Type = "tamper"
-	TamperPin  Type = "tamper-pin"
+	None             Type = "none"
+	EntryDelay       Type = "entry-delay"
+	FireVerification Type = "fire-verification"
+	Burglar          Type = "burglar"
+	Panic            Type = "panic"
+	Fire             Type = "fire"
+	Tamper           Type = "tamper"
+	TamperPin        Type = "tamper-pin"
 )
 
 func (a Type) IsValid() bool {
-	return a == None || a == Burglar || a == Panic || a == Fire || a == Tamper || a == TamperPin || a == EntryDelay
+	return a == None || a == Burglar || a == Panic || a == Fire || a == Tamper || a == TamperPin || a == EntryDelay || a == FireVerification
+}
+
+// IsPending returns true for the local pre-alarm states that are not notified and may still turn into an alarm.
+func (a Type) IsPending() bool {
+	return a == EntryDelay || a == FireVerification
 }
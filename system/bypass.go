@@ -0,0 +1,98 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+)
+
+type ZoneStatus struct {
+	Zone      zone.Zone `json:"zone"`
+	Armed     bool      `json:"armed"`
+	Triggered bool      `json:"triggered"`
+}
+
+// BypassZone excludes a zone from arming. Bypasses require a PIN, can only be changed while the system is disarmed
+// and are kept until they are removed again.
+func (w *Waechter) BypassZone(pin string, id zone.Id, bypassed bool) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	person := w.checkPin(systemDeviceId, pin)
+	if person == nil {
+		return false
+	}
+	z, ok := w.zones[id]
+	if !ok {
+		log.Warn().Str("zone", string(id)).Msg("Could not bypass unknown zone")
+		return false
+	}
+	if w.state.Armed() {
+		log.Warn().Str("zone", string(id)).Msg("Could not change bypass while armed")
+		return false
+	}
+	if z.Bypassed == bypassed {
+		return true
+	}
+
+	z.Bypassed = bypassed
+	var ids []zone.Id
+	for _, b := range w.state.Bypassed {
+		if b != id {
+			ids = append(ids, b)
+		}
+	}
+	if bypassed {
+		ids = append(ids, id)
+	}
+	w.state.Bypassed = ids
+	w.persistState()
+
+	log.Info().Str("name", person.Name).Str("zone", string(id)).Bool("bypassed", bypassed).Msg("Zone bypass changed")
+	return true
+}
+
+func (w *Waechter) applyBypasses() {
+	for _, id := range w.state.Bypassed {
+		if z, ok := w.zones[id]; ok {
+			z.Bypassed = true
+		}
+	}
+}
+
+// ZoneStatuses returns all configured zones with their arm state and whether any of their sensors is triggered.
+func (w *Waechter) ZoneStatuses() []ZoneStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	triggered := map[zone.Id]bool{}
+	w.iterateDeviceStates(func(d *device.Device, sensor device.Sensor, value any) {
+		if device.IsTriggered(value) {
+			triggered[d.Zone] = true
+		}
+	})
+
+	var result []ZoneStatus
+	for _, z := range w.zones {
+		result = append(result, ZoneStatus{
+			Zone:      *z,
+			Armed:     z.Armed,
+			Triggered: triggered[z.Id],
+		})
+	}
+	return result
+}
+
+func (w *Waechter) Arm(pin string, mode arm.Mode) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.checkPin(systemDeviceId, pin) == nil {
+		return false
+	}
+	return w.arm(systemDeviceId, mode)
+}
+
+func (w *Waechter) Disarm(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.disarm(systemDeviceId, pin)
+}
@@ -0,0 +1,149 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+	"time"
+)
+
+type debounceKey struct {
+	id     device.Id
+	sensor device.Sensor
+}
+
+type debounceState struct {
+	pending      *time.Timer
+	lastNotified map[any]time.Time
+	triggers     []time.Time
+}
+
+type debouncer struct {
+	states map[debounceKey]*debounceState
+}
+
+func newDebouncer() *debouncer {
+	return &debouncer{states: map[debounceKey]*debounceState{}}
+}
+
+func (d *debouncer) state(id device.Id, sensor device.Sensor) *debounceState {
+	k := debounceKey{id: id, sensor: sensor}
+	s, ok := d.states[k]
+	if !ok {
+		s = &debounceState{lastNotified: map[any]time.Time{}}
+		d.states[k] = s
+	}
+	return s
+}
+
+// debounceRule returns the rule for a device and sensor. A rule for the device takes precedence over a
+// rule for the sensor type only.
+func debounceRule(rules []config.DebounceConfig, id device.Id, sensor device.Sensor) *config.DebounceConfig {
+	var result *config.DebounceConfig
+	for i, r := range rules {
+		if r.Sensor != "" && r.Sensor != string(sensor) && r.Sensor != string(sensor.Base()) {
+			continue
+		}
+		if r.Device == string(id) {
+			return &rules[i]
+		}
+		if r.Device == "" && result == nil {
+			result = &rules[i]
+		}
+	}
+	return result
+}
+
+// countTrigger records a trigger and returns true once the trigger count of the rule is reached within its
+// window.
+func (s *debounceState) countTrigger(rule *config.DebounceConfig, now time.Time) bool {
+	window := time.Duration(rule.TriggerWindow) * time.Second
+	var recent []time.Time
+	for _, t := range s.triggers {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	s.triggers = append(recent, now)
+	if len(s.triggers) < rule.TriggerCount {
+		return false
+	}
+	s.triggers = nil
+	return true
+}
+
+// notifyDue returns true if the value has not been notified within the minimum interval of the rule and
+// records the notification.
+func (s *debounceState) notifyDue(rule *config.DebounceConfig, value any, now time.Time) bool {
+	if rule.MinNotifyInterval <= 0 {
+		return true
+	}
+	if t, ok := s.lastNotified[value]; ok && now.Sub(t) < time.Duration(rule.MinNotifyInterval)*time.Second {
+		return false
+	}
+	s.lastNotified[value] = now
+	return true
+}
+
+// debounce returns true if the value may be evaluated right away. Values which have to be stable for some
+// time are evaluated later by a timer, values which are suppressed are counted on the device.
+func (w *Waechter) debounce(id device.Id, sensor device.Sensor, value any) bool {
+	return w.applyDebounce(debounceRule(config.Debounce(), id, sensor), id, sensor, value)
+}
+
+func (w *Waechter) applyDebounce(rule *config.DebounceConfig, id device.Id, sensor device.Sensor, value any) bool {
+	if rule == nil {
+		return true
+	}
+
+	s := w.debouncer.state(id, sensor)
+	if rule.TriggerCount > 1 && device.IsTriggered(value) && !s.countTrigger(rule, time.Now()) {
+		w.suppressed(id, sensor, value, "trigger count not reached")
+		return false
+	}
+
+	if rule.StableTimeMs > 0 {
+		if s.pending != nil {
+			s.pending.Stop()
+			s.pending = nil
+			if w.devices[id].State[sensor] == value {
+				w.suppressed(id, sensor, value, "value reverted within stable time")
+				return false
+			}
+		}
+		var timer *time.Timer
+		timer = time.AfterFunc(time.Duration(rule.StableTimeMs)*time.Millisecond, func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			// a timer that fired while a newer value was being debounced is outdated
+			if s.pending != timer {
+				return
+			}
+			s.pending = nil
+			w.processSensorValue(id, sensor, value)
+		})
+		s.pending = timer
+		return false
+	}
+
+	return true
+}
+
+// notificationDue rate limits the notifications of a sensor. The value itself is always stored and
+// evaluated, so that no alarm is lost.
+func (w *Waechter) notificationDue(id device.Id, sensor device.Sensor, value any) bool {
+	rule := debounceRule(config.Debounce(), id, sensor)
+	if rule == nil || w.debouncer.state(id, sensor).notifyDue(rule, value, time.Now()) {
+		return true
+	}
+	w.suppressed(id, sensor, value, "minimum notification interval not reached")
+	return false
+}
+
+func (w *Waechter) suppressed(id device.Id, sensor device.Sensor, value any, reason string) {
+	d := w.devices[id]
+	if d.Suppressed == nil {
+		d.Suppressed = map[device.Sensor]int{}
+	}
+	d.Suppressed[sensor]++
+	device.DDebug(d).Str("sensor", string(sensor)).Interface("value", value).Str("reason", reason).Int("count", d.Suppressed[sensor]).Msg("Sensor value suppressed")
+}
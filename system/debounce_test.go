@@ -0,0 +1,150 @@
+package system
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+func TestDebounceRule(t *testing.T) {
+	rules := []config.DebounceConfig{
+		{Sensor: "contact", StableTimeMs: 1},
+		{Device: "z2m::Door", Sensor: "contact", StableTimeMs: 2},
+		{Device: "z2m::Hall", StableTimeMs: 3},
+		{StableTimeMs: 4},
+	}
+
+	tests := []struct {
+		name   string
+		rules  []config.DebounceConfig
+		id     device.Id
+		sensor device.Sensor
+		want   int
+	}{
+		{name: "no rules", id: "z2m::Door", sensor: device.ContactSensor, want: 0},
+		{name: "device rule wins over sensor rule", rules: rules, id: "z2m::Door", sensor: device.ContactSensor, want: 2},
+		{name: "sensor rule for other device", rules: rules, id: "z2m::Window", sensor: device.ContactSensor, want: 1},
+		{name: "endpoint sensor matches base", rules: rules, id: "z2m::Window", sensor: device.EndpointSensor(device.ContactSensor, "l1"), want: 1},
+		{name: "device rule for any sensor", rules: rules, id: "z2m::Hall", sensor: device.MotionSensor, want: 3},
+		{name: "catch all rule", rules: rules, id: "z2m::Kitchen", sensor: device.MotionSensor, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := debounceRule(tt.rules, tt.id, tt.sensor)
+			got := 0
+			if rule != nil {
+				got = rule.StableTimeMs
+			}
+			if got != tt.want {
+				t.Errorf("debounceRule() selected rule %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountTrigger(t *testing.T) {
+	rule := &config.DebounceConfig{TriggerCount: 3, TriggerWindow: 10}
+
+	tests := []struct {
+		name     string
+		triggers []time.Duration
+		want     []bool
+	}{
+		{name: "single trigger", triggers: []time.Duration{0}, want: []bool{false}},
+		{name: "count reached within window", triggers: []time.Duration{0, 2 * time.Second, 4 * time.Second}, want: []bool{false, false, true}},
+		{name: "count starts over after reached", triggers: []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second}, want: []bool{false, false, true, false}},
+		{name: "old triggers expire", triggers: []time.Duration{0, time.Second, 12 * time.Second, 13 * time.Second}, want: []bool{false, false, false, false}},
+		{name: "window slides", triggers: []time.Duration{0, 8 * time.Second, 12 * time.Second, 14 * time.Second}, want: []bool{false, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &debounceState{lastNotified: map[any]time.Time{}}
+			start := time.Now()
+			for i, offset := range tt.triggers {
+				if got := s.countTrigger(rule, start.Add(offset)); got != tt.want[i] {
+					t.Errorf("trigger %d: countTrigger() = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyDue(t *testing.T) {
+	open := device.ContactSensorValue{Contact: false}
+	closed := device.ContactSensorValue{Contact: true}
+
+	type event struct {
+		offset time.Duration
+		value  any
+		want   bool
+	}
+	tests := []struct {
+		name     string
+		interval int
+		events   []event
+	}{
+		{name: "no interval", interval: 0, events: []event{{0, open, true}, {time.Second, open, true}}},
+		{name: "same value within interval", interval: 60, events: []event{{0, open, true}, {time.Second, closed, true}, {2 * time.Second, open, false}}},
+		{name: "same value after interval", interval: 60, events: []event{{0, open, true}, {61 * time.Second, open, true}}},
+		{name: "suppressed value does not extend interval", interval: 60, events: []event{{0, open, true}, {50 * time.Second, open, false}, {61 * time.Second, open, true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &config.DebounceConfig{MinNotifyInterval: tt.interval}
+			s := &debounceState{lastNotified: map[any]time.Time{}}
+			start := time.Now()
+			for i, e := range tt.events {
+				if got := s.notifyDue(rule, e.value, start.Add(e.offset)); got != e.want {
+					t.Errorf("event %d: notifyDue() = %v, want %v", i, got, e.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDebounce(t *testing.T) {
+	id := device.Id("z2m::Door")
+	open := device.ContactSensorValue{Contact: false}
+	closed := device.ContactSensorValue{Contact: true}
+
+	tests := []struct {
+		name       string
+		rule       *config.DebounceConfig
+		state      any
+		values     []any
+		want       []bool
+		suppressed int
+	}{
+		{name: "no rule", values: []any{open, closed}, want: []bool{true, true}},
+		{name: "trigger count", rule: &config.DebounceConfig{TriggerCount: 2, TriggerWindow: 10}, state: closed, values: []any{open, closed, open}, want: []bool{false, true, true}, suppressed: 1},
+		{name: "stable time defers value", rule: &config.DebounceConfig{StableTimeMs: 60000}, state: closed, values: []any{open}, want: []bool{false}},
+		{name: "value reverted within stable time", rule: &config.DebounceConfig{StableTimeMs: 60000}, state: closed, values: []any{open, closed}, want: []bool{false, false}, suppressed: 1},
+		{name: "minimum interval does not suppress values", rule: &config.DebounceConfig{MinNotifyInterval: 60}, state: closed, values: []any{open, closed, open}, want: []bool{true, true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := device.NewDevice(id)
+			if tt.state != nil {
+				d.State[device.ContactSensor] = tt.state
+			}
+			w := &Waechter{debouncer: newDebouncer(), devices: map[device.Id]*device.Device{id: &d}}
+			for i, v := range tt.values {
+				if got := w.applyDebounce(tt.rule, id, device.ContactSensor, v); got != tt.want[i] {
+					t.Errorf("value %d: applyDebounce() = %v, want %v", i, got, tt.want[i])
+				}
+			}
+			if got := d.Suppressed[device.ContactSensor]; got != tt.suppressed {
+				t.Errorf("suppressed = %d, want %d", got, tt.suppressed)
+			}
+			if s := w.debouncer.state(id, device.ContactSensor); s.pending != nil {
+				s.pending.Stop()
+			}
+		})
+	}
+}
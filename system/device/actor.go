@@ -3,6 +3,7 @@ package device
 import (
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/arm"
+	"strings"
 )
 
 type Actor string
@@ -12,13 +13,37 @@ const (
 	StateActor             Actor = "state"
 	NotificationShortActor Actor = "notification-short"
 	NotificationLongActor  Actor = "notification-long"
+	SquawkActor            Actor = "squawk"
+	// SwitchActor is a relay or plug, it is only controlled on request and never on alarm
+	SwitchActor Actor = "switch"
 )
 
+// EndpointActor returns the actor of a single endpoint of a device with several actors of the same kind.
+func EndpointActor(a Actor, endpoint string) Actor {
+	return Actor(string(a) + "@" + endpoint)
+}
+
+// Base returns the kind of the actor without endpoint.
+func (a Actor) Base() Actor {
+	base, _, _ := strings.Cut(string(a), "@")
+	return Actor(base)
+}
+
 type AlarmActorPayload struct {
-	Alarm alarm.Type
+	Alarm    alarm.Type
+	Silenced bool
 }
 
-type StateActorPayload struct {
+type SquawkActorPayload struct {
 	ArmMode arm.Mode
-	Alarm   alarm.Type
+}
+
+type SwitchActorPayload struct {
+	On bool
+}
+
+type StateActorPayload struct {
+	ArmMode  arm.Mode
+	Alarm    alarm.Type
+	Silenced bool
 }
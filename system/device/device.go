@@ -5,14 +5,18 @@ import (
 	"github.com/mtrossbach/waechter/internal/log"
 	"github.com/mtrossbach/waechter/system/zone"
 	"github.com/rs/zerolog"
+	"time"
 )
 
 type Device struct {
-	Id     Id             `json:"id"`
-	Zone   zone.Id        `json:"zone"`
-	Active bool           `json:"-"`
-	Spec   Spec           `json:"-"`
-	State  map[Sensor]any `json:"-"`
+	Id              Id             `json:"id"`
+	Zone            zone.Id        `json:"zone"`
+	Active          bool           `json:"-"`
+	Spec            Spec           `json:"-"`
+	State           map[Sensor]any `json:"-"`
+	LastSeen        time.Time      `json:"-"`
+	SupervisionLost bool           `json:"-"`
+	Suppressed      map[Sensor]int `json:"-"`
 }
 
 func DeviceFromConfig(config config.DeviceConfig) Device {
@@ -28,7 +32,7 @@ func DeviceFromConfig(config config.DeviceConfig) Device {
 func NewDevice(id Id) Device {
 	return Device{
 		Id:     Id(id),
-		Zone:   zone.Id("any"),
+		Zone:   zone.NoZone,
 		Active: false,
 		Spec:   Spec{},
 		State:  map[Sensor]any{},
@@ -2,6 +2,7 @@ package device
 
 import (
 	"github.com/mtrossbach/waechter/system/arm"
+	"strings"
 )
 
 type Sensor string
@@ -10,17 +11,36 @@ const (
 	MotionSensor         Sensor = "motion"
 	ContactSensor        Sensor = "contact"
 	SmokeSensor          Sensor = "smoke"
+	VibrationSensor      Sensor = "vibration"
+	LockSensor           Sensor = "lock"
 	PanicSensor          Sensor = "panic"
+	FireSensor           Sensor = "fire"
 	BatteryWarningSensor Sensor = "battery-warning"
 	TamperSensor         Sensor = "tamper"
 	BatteryLevelSensor   Sensor = "battery-level"
 	LinkQualitySensor    Sensor = "link-quality"
 	ArmingSensor         Sensor = "arming"
 	DisarmingSensor      Sensor = "disarming"
+	SilencingSensor      Sensor = "silencing"
+	ResettingSensor      Sensor = "resetting"
+	AcknowledgingSensor  Sensor = "acknowledging"
+	WalkTestSensor       Sensor = "walk-test"
+	MaintenanceSensor    Sensor = "maintenance"
 	Humidity             Sensor = "humidity"
 	Temperature          Sensor = "temperature"
 )
 
+// EndpointSensor returns the sensor of a single endpoint of a device with several sensors of the same kind.
+func EndpointSensor(s Sensor, endpoint string) Sensor {
+	return Sensor(string(s) + "@" + endpoint)
+}
+
+// Base returns the kind of the sensor without endpoint.
+func (s Sensor) Base() Sensor {
+	base, _, _ := strings.Cut(string(s), "@")
+	return Sensor(base)
+}
+
 type MotionSensorValue struct {
 	Motion bool
 }
@@ -33,10 +53,23 @@ type SmokeSensorValue struct {
 	Smoke bool
 }
 
+type VibrationSensorValue struct {
+	Vibration bool
+}
+
+type LockSensorValue struct {
+	Locked bool
+}
+
 type PanicSensorValue struct {
 	Panic bool
 }
 
+// FireSensorValue is a manual fire alarm, e.g. from a keypad or a call point.
+type FireSensorValue struct {
+	Fire bool
+}
+
 type BatteryWarningSensorValue struct {
 	BatteryWarning bool
 }
@@ -62,9 +95,53 @@ type TemperatureSensorValue struct {
 }
 
 type ArmingSensorValue struct {
-	ArmMode arm.Mode
+	ArmMode     arm.Mode
+	Pin         string
+	PinRequired bool
 }
 
 type DisarmingSensorValue struct {
 	Pin string
 }
+
+type SilencingSensorValue struct {
+	Pin string
+}
+
+type ResettingSensorValue struct {
+	Pin string
+}
+
+type AcknowledgingSensorValue struct {
+	Pin string
+}
+
+type WalkTestSensorValue struct {
+	Pin string
+}
+
+type MaintenanceSensorValue struct {
+	Pin string
+}
+
+// IsTriggered returns true if the value reports an event relevant for intrusion or fire detection.
+func IsTriggered(value any) bool {
+	if v, ok := value.(MotionSensorValue); ok {
+		return v.Motion
+	} else if v, ok := value.(ContactSensorValue); ok {
+		return !v.Contact
+	} else if v, ok := value.(SmokeSensorValue); ok {
+		return v.Smoke
+	} else if v, ok := value.(VibrationSensorValue); ok {
+		return v.Vibration
+	} else if v, ok := value.(LockSensorValue); ok {
+		return !v.Locked
+	} else if v, ok := value.(PanicSensorValue); ok {
+		return v.Panic
+	} else if v, ok := value.(FireSensorValue); ok {
+		return v.Fire
+	} else if v, ok := value.(TamperSensorValues); ok {
+		return v.Tamper
+	}
+	return false
+}
@@ -9,8 +9,11 @@ type Spec struct {
 	Vendor      string
 	Model       string
 	Description string
+	Area        string
 	Sensors     []Sensor
 	Actors      []Actor
+	// FormerIds are ids the connector used for the device before, their registry entries move to Id
+	FormerIds []Id
 }
 
 func (s Spec) HumanReadableName() string {
@@ -20,7 +23,16 @@ func (s Spec) HumanReadableName() string {
 	return string(s.Id)
 }
 
+// BaseSensors returns the kinds of sensors of the device.
+func (s Spec) BaseSensors() []Sensor {
+	var result []Sensor
+	for _, sensor := range s.Sensors {
+		result = append(result, sensor.Base())
+	}
+	return result
+}
+
 func (s Spec) IsRelevant() bool {
-	return len(s.Actors) > 0 || wslice.ContainsAny(s.Sensors,
-		[]Sensor{MotionSensor, ContactSensor, Humidity, Temperature, SmokeSensor, PanicSensor, TamperSensor, ArmingSensor, DisarmingSensor})
+	return len(s.Actors) > 0 || wslice.ContainsAny(s.BaseSensors(),
+		[]Sensor{MotionSensor, ContactSensor, VibrationSensor, LockSensor, Humidity, Temperature, SmokeSensor, PanicSensor, TamperSensor, ArmingSensor, DisarmingSensor})
 }
@@ -1,7 +1,11 @@
 package system
 
 import (
+	"github.com/mtrossbach/waechter/system/arm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"github.com/mtrossbach/waechter/system/zone"
+	"time"
 )
 
 type DeviceConnector interface {
@@ -23,8 +27,23 @@ type DeviceConnector interface {
 	DisconnectForReconnect()
 }
 
+// GroupActorConnector is implemented by connectors that can control an actor of several devices with a single
+// message, so that e.g. all sirens start at the same time.
+type GroupActorConnector interface {
+	// ControlActorGroup controls the actor of the given devices and returns the devices that were handled.
+	ControlActorGroup(ids []device.Id, actor device.Actor, value any) []device.Id
+}
+
+// PairingConnector is implemented by connectors that can pair and manage devices.
+type PairingConnector interface {
+	PermitJoin(duration time.Duration) error
+	RenameDevice(id device.Id, name string) error
+	RemoveDevice(id device.Id) error
+}
+
 type Controller interface {
 	DeliverSensorValue(id device.Id, sensor device.Sensor, value any) bool
+	ReconcileSensorValue(id device.Id, sensor device.Sensor, value any)
 
 	DeviceListUpdated(connector DeviceConnector)
 
@@ -32,10 +51,44 @@ type Controller interface {
 
 	DeviceUnavailable(id device.Id)
 	DeviceAvailable(id device.Id)
+	DeviceSeen(id device.Id)
+	ActorControlled(id device.Id, actor device.Actor, err error)
+	DevicePairingEvent(connector DeviceConnector, event PairingEvent)
 
 	SystemState() State
 
 	DeviceConnectorForId(id string) DeviceConnector
 
 	DeviceSensorValue(id device.Id, sensor device.Sensor) interface{}
+
+	DeviceStatuses() []DeviceStatus
+
+	Troubles() []trouble.Trouble
+	AcknowledgeTroubles(pin string) bool
+
+	Arm(pin string, mode arm.Mode) bool
+	Disarm(pin string) bool
+	ZoneStatuses() []ZoneStatus
+	BypassZone(pin string, id zone.Id, bypassed bool) bool
+
+	SilenceAlarm(pin string) bool
+	ResetAlarm(pin string) bool
+
+	AlarmMemory() []AlarmMemoryEntry
+	ClearAlarmMemory(pin string) bool
+
+	StartWalkTest(pin string) bool
+	StopWalkTest(pin string) bool
+	WalkTestReport() *WalkTestReport
+
+	StartMaintenance(pin string, devices []device.Id) bool
+	StopMaintenance(pin string) bool
+	DeviceRegistry() []RegistryEntry
+	UpdateDeviceRegistry(pin string, id device.Id, displayName string, enabled bool) bool
+
+	StartPairing(pin string, connectorId string, duration int) bool
+	StopPairing(pin string) bool
+	PairingStatus() *PairingStatus
+	AssignDevice(pin string, id device.Id, name string, zone zone.Id) bool
+	RemoveDevice(pin string, id device.Id) bool
 }
@@ -0,0 +1,91 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/device"
+	"time"
+)
+
+type fireVerification struct {
+	device     device.Id
+	persistent *time.Timer
+	window     *time.Timer
+}
+
+// smokeDetected raises a fire alarm. With fire verification enabled the first detection only raises a local
+// pre-alarm which is confirmed by persistent smoke or by a repeated detection within the verification window.
+func (w *Waechter) smokeDetected(id device.Id) {
+	if !config.Fire().Verification || w.state.Alarm == alarm.Fire {
+		w.alarm(id, alarm.Fire, false)
+		return
+	}
+
+	if w.fireVerification != nil {
+		log.Info().Str("device", string(id)).Msg("Smoke detected again during verification")
+		w.confirmFire(id)
+		return
+	}
+
+	if w.state.Alarm != alarm.None {
+		w.alarm(id, alarm.Fire, false)
+		return
+	}
+
+	fv := &fireVerification{device: id}
+	fv.persistent = time.AfterFunc(time.Duration(config.Fire().VerificationTime)*time.Second, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if w.fireVerification != fv {
+			return
+		}
+		if d, ok := w.devices[id]; ok && wslice.Contains(w.DetectingSmokeSensors(), d) {
+			log.Info().Str("device", string(id)).Msg("Smoke still detected after verification time")
+			w.confirmFire(id)
+		}
+	})
+	fv.window = time.AfterFunc(time.Duration(config.Fire().VerificationWindow)*time.Second, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if w.fireVerification != fv {
+			return
+		}
+		log.Info().Str("device", string(id)).Msg("Fire not confirmed within verification window")
+		w.stopFireVerification()
+		if w.state.Alarm == alarm.FireVerification {
+			w.setAlarm(alarm.None)
+		}
+	})
+	w.fireVerification = fv
+
+	log.Info().Str("device", string(id)).Int("verificationTime", config.Fire().VerificationTime).Int("verificationWindow", config.Fire().VerificationWindow).Msg("Fire pre-alarm")
+	w._alarm(id, alarm.FireVerification)
+}
+
+// confirmFire raises the fire alarm, which drives all sirens and sounding smoke detectors together.
+func (w *Waechter) confirmFire(id device.Id) {
+	w.stopFireVerification()
+	w._alarm(id, alarm.Fire)
+}
+
+func (w *Waechter) stopFireVerification() {
+	fv := w.fireVerification
+	if fv == nil {
+		return
+	}
+	fv.persistent.Stop()
+	fv.window.Stop()
+	w.fireVerification = nil
+}
+
+// checkFireCleared ends a fire alarm once it has been acknowledged and every smoke detector reports clear.
+func (w *Waechter) checkFireCleared() {
+	if w.state.Alarm != alarm.Fire || !w.state.Silenced || len(w.DetectingSmokeSensors()) > 0 {
+		return
+	}
+	log.Info().Msg("All smoke detectors clear, fire alarm ended")
+	w.noteMgr.NotifyRecovery(w.specForDeviceId(systemDeviceId), w.zoneForDeviceId(systemDeviceId))
+	w.setAlarm(alarm.None)
+}
@@ -0,0 +1,102 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/device"
+	"time"
+)
+
+type maintenance struct {
+	started time.Time
+	devices []device.Id
+	timer   *time.Timer
+}
+
+// covers returns true if the device is under maintenance. An empty device selection covers all devices.
+func (m *maintenance) covers(id device.Id) bool {
+	return len(m.devices) == 0 || wslice.Contains(m.devices, id)
+}
+
+func (w *Waechter) inMaintenance(id device.Id) bool {
+	m := w.maintenance
+	return m != nil && m.covers(id)
+}
+
+func (w *Waechter) startMaintenance(id device.Id, enteredPin string, devices []device.Id) bool {
+	person := w.checkAdminPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	if w.state.Armed() || w.maintenance != nil {
+		log.Warn().Bool("armed", w.state.Armed()).Bool("maintenance", w.maintenance != nil).Msg("Could not start maintenance mode")
+		return false
+	}
+
+	timeout := time.Duration(config.General().MaintenanceTimeout) * time.Second
+	m := &maintenance{
+		started: time.Now(),
+		devices: devices,
+	}
+	m.timer = time.AfterFunc(timeout, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if w.maintenance != m {
+			return
+		}
+		log.Info().Dur("timeout", timeout).Msg("Maintenance mode timed out")
+		w.endMaintenance()
+	})
+	w.maintenance = m
+
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, string(d))
+	}
+	log.Info().Str("name", person.Name).Dur("timeout", timeout).Strs("devices", ids).Msg("➔ Maintenance mode started")
+	w.notificationBeep(true)
+	return true
+}
+
+func (w *Waechter) stopMaintenance(id device.Id, enteredPin string) bool {
+	person := w.checkAdminPin(id, enteredPin)
+	if person == nil || w.maintenance == nil {
+		return false
+	}
+	log.Info().Str("name", person.Name).Msg("Maintenance mode stopped")
+	w.endMaintenance()
+	return true
+}
+
+func (w *Waechter) endMaintenance() {
+	m := w.maintenance
+	if m == nil {
+		return
+	}
+	m.timer.Stop()
+	w.maintenance = nil
+
+	var tampered []device.Spec
+	for _, d := range w.DevicesWithTamper() {
+		if m.covers(d.Id) {
+			device.DError(d).Msg("! Device is still tampered after maintenance!")
+			tampered = append(tampered, d.Spec)
+		}
+	}
+	log.Info().Dur("duration", time.Now().Sub(m.started)).Int("tampered", len(tampered)).Msg("➔ Maintenance mode ended")
+	w.notificationBeep(true)
+	w.noteMgr.NotifyMaintenanceEnded(tampered)
+}
+
+func (w *Waechter) StartMaintenance(pin string, devices []device.Id) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.startMaintenance(systemDeviceId, pin, devices)
+}
+
+func (w *Waechter) StopMaintenance(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.stopMaintenance(systemDeviceId, pin)
+}
@@ -0,0 +1,82 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+	"time"
+)
+
+const maxAlarmMemoryEntries = 100
+
+type AlarmMemoryEntry struct {
+	Time       time.Time  `json:"time"`
+	Alarm      alarm.Type `json:"alarm"`
+	Device     device.Id  `json:"device"`
+	DeviceName string     `json:"deviceName"`
+	Zone       zone.Id    `json:"zone"`
+	ZoneName   string     `json:"zoneName"`
+	// Period is the time the arm mode that was active when the alarm occurred was set, it scopes the entries
+	// to an arming (or disarmed) period.
+	Period time.Time `json:"period"`
+}
+
+// rememberAlarm records a confirmed alarm, pending stages like the entry delay are not recorded.
+func (w *Waechter) rememberAlarm(id device.Id, a alarm.Type) {
+	if a.IsPending() {
+		return
+	}
+	z := w.zoneForDeviceId(id)
+	w.state.AlarmMemory = append(w.state.AlarmMemory, AlarmMemoryEntry{
+		Time:       time.Now(),
+		Period:     w.state.ArmModeUpdated,
+		Alarm:      a,
+		Device:     id,
+		DeviceName: w.specForDeviceId(id).HumanReadableName(),
+		Zone:       z.Id,
+		ZoneName:   z.DisplayName,
+	})
+	if len(w.state.AlarmMemory) > maxAlarmMemoryEntries {
+		w.state.AlarmMemory = w.state.AlarmMemory[len(w.state.AlarmMemory)-maxAlarmMemoryEntries:]
+	}
+	w.persistState()
+}
+
+// reportAlarmMemory is called on disarm and tells everybody which devices tripped during the period that just
+// ended before they walk in. Entries of earlier periods have been reported already.
+func (w *Waechter) reportAlarmMemory(period time.Time) {
+	var entries []AlarmMemoryEntry
+	for _, e := range w.state.AlarmMemory {
+		if e.Period.Equal(period) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	for _, e := range entries {
+		log.Warn().Time("time", e.Time).Str("alarm", string(e.Alarm)).Str("device", string(e.Device)).Str("zone", string(e.Zone)).Msg("! Alarm memory")
+	}
+	w.notificationBeep(true)
+	w.noteMgr.NotifyAlarmMemory(entries)
+}
+
+func (w *Waechter) AlarmMemory() []AlarmMemoryEntry {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]AlarmMemoryEntry{}, w.state.AlarmMemory...)
+}
+
+func (w *Waechter) ClearAlarmMemory(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	person := w.checkPin(systemDeviceId, pin)
+	if person == nil {
+		return false
+	}
+	log.Info().Str("name", person.Name).Int("entries", len(w.state.AlarmMemory)).Msg("Alarm memory cleared")
+	w.state.AlarmMemory = nil
+	w.persistState()
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/mtrossbach/waechter/internal/config"
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/mtrossbach/waechter/system/zone"
 )
 
@@ -20,6 +21,13 @@ type NotificationAdapter interface {
 	NotifyLinkQuality(person config.Person, systemName string, device device.Spec, zone zone.Zone, quality float32) bool
 	NotifyHumidityValue(person config.Person, systemName string, device device.Spec, zone zone.Zone, humidity float32) bool
 	NotifyTemperatureValue(person config.Person, systemName string, device device.Spec, zone zone.Zone, temperature float32) bool
+	NotifyTrouble(person config.Person, systemName string, t trouble.Trouble, device device.Spec, zone zone.Zone) bool
+	NotifyTroubleCleared(person config.Person, systemName string, t trouble.Trouble, device device.Spec, zone zone.Zone) bool
+	NotifyAlarmMemory(person config.Person, systemName string, entries []AlarmMemoryEntry) bool
+	NotifyWalkTestReport(person config.Person, systemName string, report WalkTestReport) bool
+	NotifyMaintenanceEnded(person config.Person, systemName string, tampered []device.Spec) bool
+	NotifyDiscoveredWhileOffline(person config.Person, systemName string, device device.Spec, zone zone.Zone, sensor device.Sensor) bool
+	NotifyDeviceJoined(person config.Person, systemName string, device device.Spec, zone zone.Zone) bool
 	NotifyAutoArm(person config.Person, systemName string) bool
 	NotifyAutoDisarm(person config.Person, systemName string) bool
 }
@@ -5,15 +5,35 @@ import (
 	"github.com/mtrossbach/waechter/internal/log"
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/mtrossbach/waechter/system/zone"
 )
 
+// notificationQueueSize is the number of notifications waiting for delivery before new ones are dropped.
+const notificationQueueSize = 100
+
+// notificationManager delivers notifications in order on its own goroutine, so that slow notification channels
+// do not block the event handling.
 type notificationManager struct {
 	adapters []NotificationAdapter
+	queue    chan func()
+
+	onDelivery func(ok bool)
 }
 
 func newNotificationManager() *notificationManager {
-	return &notificationManager{adapters: []NotificationAdapter{}}
+	n := &notificationManager{
+		adapters: []NotificationAdapter{},
+		queue:    make(chan func(), notificationQueueSize),
+	}
+	go n.deliver()
+	return n
+}
+
+func (n *notificationManager) deliver() {
+	for f := range n.queue {
+		f()
+	}
 }
 
 func (n *notificationManager) AddAdapter(adapter NotificationAdapter) {
@@ -24,7 +44,22 @@ func (n *notificationManager) allPersons() []config.Person {
 	return config.Persons()
 }
 
+// notify queues a notification to every person. onDelivery is called from the delivery goroutine once per
+// notification and reports whether it reached every person. The queue never blocks, as notify is called while
+// holding the event lock, which onDelivery needs as well.
 func (n *notificationManager) notify(persons []config.Person, handler func(person config.Person, adapter NotificationAdapter) bool) {
+	select {
+	case n.queue <- func() { n.send(persons, handler) }:
+	default:
+		log.Error().Msg("Notification queue full, dropping notification")
+		if n.onDelivery != nil && len(n.adapters) > 0 && len(persons) > 0 {
+			go n.onDelivery(false)
+		}
+	}
+}
+
+func (n *notificationManager) send(persons []config.Person, handler func(person config.Person, adapter NotificationAdapter) bool) {
+	delivered := true
 	for _, p := range persons {
 		var successAdapter NotificationAdapter
 		for _, a := range n.adapters {
@@ -35,8 +70,14 @@ func (n *notificationManager) notify(persons []config.Person, handler func(perso
 		}
 		if successAdapter != nil {
 			log.Info().Str("name", p.Name).Str("adapter", successAdapter.Name()).Msg("Sent notification")
+		} else if len(n.adapters) > 0 {
+			log.Error().Str("name", p.Name).Msg("Could not send notification via any adapter")
+			delivered = false
 		}
 	}
+	if n.onDelivery != nil && len(n.adapters) > 0 && len(persons) > 0 {
+		n.onDelivery(delivered)
+	}
 }
 
 func (n *notificationManager) NotifyAlarm(a alarm.Type, device device.Spec, zone zone.Zone) {
@@ -105,6 +146,48 @@ func (n *notificationManager) NotifySmokeSensor(device device.Spec, zone zone.Zo
 	})
 }
 
+func (n *notificationManager) NotifyTrouble(t trouble.Trouble, device device.Spec, zone zone.Zone) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyTrouble(person, config.General().Name, t, device, zone)
+	})
+}
+
+func (n *notificationManager) NotifyTroubleCleared(t trouble.Trouble, device device.Spec, zone zone.Zone) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyTroubleCleared(person, config.General().Name, t, device, zone)
+	})
+}
+
+func (n *notificationManager) NotifyAlarmMemory(entries []AlarmMemoryEntry) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyAlarmMemory(person, config.General().Name, entries)
+	})
+}
+
+func (n *notificationManager) NotifyWalkTestReport(report WalkTestReport) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyWalkTestReport(person, config.General().Name, report)
+	})
+}
+
+func (n *notificationManager) NotifyMaintenanceEnded(tampered []device.Spec) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyMaintenanceEnded(person, config.General().Name, tampered)
+	})
+}
+
+func (n *notificationManager) NotifyDiscoveredWhileOffline(device device.Spec, zone zone.Zone, sensor device.Sensor) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyDiscoveredWhileOffline(person, config.General().Name, device, zone, sensor)
+	})
+}
+
+func (n *notificationManager) NotifyDeviceJoined(device device.Spec, zone zone.Zone) {
+	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
+		return adapter.NotifyDeviceJoined(person, config.General().Name, device, zone)
+	})
+}
+
 func (n *notificationManager) NotifyAutoArm() {
 	n.notify(n.allPersons(), func(person config.Person, adapter NotificationAdapter) bool {
 		return adapter.NotifyAutoArm(person, config.General().Name)
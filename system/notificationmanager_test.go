@@ -0,0 +1,70 @@
+package system
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtrossbach/waechter/internal/config"
+)
+
+type testAdapter struct {
+	NotificationAdapter
+}
+
+func (testAdapter) Name() string { return "test" }
+
+func TestNotifyDoesNotBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     []bool
+		wantOk   []bool
+		blocking bool
+	}{
+		{name: "delivered", sent: []bool{true}, wantOk: []bool{true}},
+		{name: "failed", sent: []bool{false}, wantOk: []bool{false}},
+		{name: "in order", sent: []bool{false, true}, wantOk: []bool{false, true}},
+		{name: "slow channel", sent: []bool{true}, wantOk: []bool{true}, blocking: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNotificationManager()
+			n.AddAdapter(testAdapter{})
+			delivered := make(chan bool, len(tt.sent))
+			n.onDelivery = func(ok bool) { delivered <- ok }
+
+			release := make(chan struct{})
+			persons := []config.Person{{Name: "John Doe"}}
+			for _, ok := range tt.sent {
+				ok := ok
+				done := make(chan struct{})
+				go func() {
+					n.notify(persons, func(config.Person, NotificationAdapter) bool {
+						if tt.blocking {
+							<-release
+						}
+						return ok
+					})
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("notify blocked")
+				}
+			}
+			close(release)
+
+			for i, want := range tt.wantOk {
+				select {
+				case got := <-delivered:
+					if got != want {
+						t.Errorf("delivery %d = %v, want %v", i, got, want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("delivery %d not reported", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+	"time"
+)
+
+type PairingEventType string
+
+const (
+	DeviceJoined           PairingEventType = "joined"
+	DeviceInterviewStarted PairingEventType = "interview-started"
+	DeviceInterviewed      PairingEventType = "interview-successful"
+	DeviceInterviewFailed  PairingEventType = "interview-failed"
+	DeviceLeft             PairingEventType = "left"
+)
+
+type PairingEvent struct {
+	Time        time.Time        `json:"time"`
+	Type        PairingEventType `json:"type"`
+	Id          device.Id        `json:"id"`
+	IeeeAddress string           `json:"ieeeAddress"`
+}
+
+type PairingStatus struct {
+	Connector string         `json:"connector"`
+	Started   time.Time      `json:"started"`
+	Until     time.Time      `json:"until"`
+	Events    []PairingEvent `json:"events"`
+}
+
+type pairing struct {
+	status PairingStatus
+	timer  *time.Timer
+}
+
+func (w *Waechter) startPairing(id device.Id, enteredPin string, connectorId string, duration int) bool {
+	person := w.checkAdminPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	if w.state.Armed() || w.pairing != nil {
+		log.Warn().Bool("armed", w.state.Armed()).Bool("pairing", w.pairing != nil).Msg("Could not start pairing")
+		return false
+	}
+	pc, ok := w.DeviceConnectorForId(connectorId).(PairingConnector)
+	if !ok {
+		log.Warn().Str("connector", connectorId).Msg("Connector does not support pairing")
+		return false
+	}
+
+	d := time.Duration(duration) * time.Second
+	if err := pc.PermitJoin(d); err != nil {
+		log.Error().Err(err).Str("connector", connectorId).Msg("Could not permit joining")
+		return false
+	}
+
+	now := time.Now()
+	p := &pairing{status: PairingStatus{
+		Connector: connectorId,
+		Started:   now,
+		Until:     now.Add(d),
+		Events:    []PairingEvent{},
+	}}
+	p.timer = time.AfterFunc(d, func() {
+		w.locked(func() {
+			if w.pairing == p {
+				log.Info().Str("connector", connectorId).Msg("Pairing timed out")
+				w.endPairing()
+			}
+		})
+	})
+	w.pairing = p
+
+	log.Info().Str("name", person.Name).Str("connector", connectorId).Dur("duration", d).Msg("➔ Pairing started")
+	w.notificationBeep(true)
+	return true
+}
+
+// endPairing closes joining when pairing is stopped or timed out. Joining is closed explicitly, as the connector
+// may not enforce the duration itself.
+func (w *Waechter) endPairing() {
+	p := w.pairing
+	if p == nil {
+		return
+	}
+	p.timer.Stop()
+	w.pairing = nil
+
+	if pc, ok := w.DeviceConnectorForId(p.status.Connector).(PairingConnector); ok {
+		if err := pc.PermitJoin(0); err != nil {
+			log.Error().Err(err).Str("connector", p.status.Connector).Msg("Could not stop permitting joining")
+		}
+	}
+	log.Info().Str("connector", p.status.Connector).Msg("➔ Pairing ended")
+}
+
+func (w *Waechter) DevicePairingEvent(connector DeviceConnector, event PairingEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	l := log.Info()
+	if event.Type == DeviceJoined && w.state.Armed() {
+		l = log.Error()
+	}
+	l.Str("connector", connector.Id()).Str("type", string(event.Type)).Str("id", string(event.Id)).Str("ieeeAddress", event.IeeeAddress).Bool("pairing", w.pairing != nil).Msg("Pairing event")
+
+	if p := w.pairing; p != nil && p.status.Connector == connector.Id() {
+		p.status.Events = append(p.status.Events, event)
+		if event.Type == DeviceInterviewed {
+			w.notificationBeep(false)
+		}
+	}
+}
+
+func (w *Waechter) StartPairing(pin string, connectorId string, duration int) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.startPairing(systemDeviceId, pin, connectorId, duration)
+}
+
+func (w *Waechter) StopPairing(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	person := w.checkAdminPin(systemDeviceId, pin)
+	if person == nil || w.pairing == nil {
+		return false
+	}
+	log.Info().Str("name", person.Name).Msg("Pairing stopped")
+	w.endPairing()
+	return true
+}
+
+// PairingStatus returns the running pairing with the events seen so far.
+func (w *Waechter) PairingStatus() *PairingStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	p := w.pairing
+	if p == nil {
+		return nil
+	}
+	status := p.status
+	status.Events = append([]PairingEvent{}, p.status.Events...)
+	return &status
+}
+
+// AssignDevice names a device and assigns it to a zone. Renaming changes the id of the device, its registry
+// entry moves along and the connector lists it under the new id.
+func (w *Waechter) AssignDevice(pin string, id device.Id, name string, zoneId zone.Id) bool {
+	w.mutex.Lock()
+	renamed, ok := w.assignDevice(pin, id, name, zoneId)
+	w.mutex.Unlock()
+
+	if renamed {
+		w.deactivateForgotten(id)
+	}
+	return ok
+}
+
+func (w *Waechter) assignDevice(pin string, id device.Id, name string, zoneId zone.Id) (bool, bool) {
+	person := w.checkAdminPin(systemDeviceId, pin)
+	if person == nil {
+		return false, false
+	}
+	if _, ok := w.zones[zoneId]; !ok {
+		log.Warn().Str("zone", string(zoneId)).Msg("Could not assign device to unknown zone")
+		return false, false
+	}
+
+	newId := id
+	if len(name) > 0 && name != id.Entity() {
+		pc, ok := w.DeviceConnectorForId(id.Prefix()).(PairingConnector)
+		if !ok {
+			log.Warn().Str("connector", id.Prefix()).Msg("Connector does not support renaming devices")
+			return false, false
+		}
+		newId = device.NewId(id.Prefix(), name)
+		w.registry.rename(id, newId)
+		if err := pc.RenameDevice(id, name); err != nil {
+			log.Error().Err(err).Str("id", string(id)).Str("name", name).Msg("Could not rename device")
+			w.registry.rename(newId, id)
+			return false, false
+		}
+		w.forgetDevice(id)
+	}
+
+	w.registry.assignZone(newId, zoneId)
+	if d, ok := w.devices[newId]; ok {
+		w.updateZone(d)
+		w.updateRegistryZone(d.Id, d.Zone)
+	}
+	w.persistRegistry()
+
+	log.Info().Str("name", person.Name).Str("id", string(newId)).Str("zone", string(zoneId)).Msg("Device assigned")
+	return newId != id, true
+}
+
+func (w *Waechter) RemoveDevice(pin string, id device.Id) bool {
+	w.mutex.Lock()
+	ok := w.removeDevice(pin, id)
+	w.mutex.Unlock()
+
+	if ok {
+		w.deactivateForgotten(id)
+	}
+	return ok
+}
+
+func (w *Waechter) removeDevice(pin string, id device.Id) bool {
+	person := w.checkAdminPin(systemDeviceId, pin)
+	if person == nil {
+		return false
+	}
+	if w.state.Armed() {
+		log.Warn().Str("id", string(id)).Msg("Could not remove device while armed")
+		return false
+	}
+	pc, ok := w.DeviceConnectorForId(id.Prefix()).(PairingConnector)
+	if !ok {
+		log.Warn().Str("connector", id.Prefix()).Msg("Connector does not support removing devices")
+		return false
+	}
+	if err := pc.RemoveDevice(id); err != nil {
+		log.Error().Err(err).Str("id", string(id)).Msg("Could not remove device")
+		return false
+	}
+
+	w.registry.remove(id)
+	w.forgetDevice(id)
+	w.persistRegistry()
+	log.Info().Str("name", person.Name).Str("id", string(id)).Msg("Device removed")
+	return true
+}
+
+// forgetDevice drops a renamed or removed device, so that it is no longer supervised or listed, and clears its
+// troubles.
+func (w *Waechter) forgetDevice(id device.Id) {
+	delete(w.devices, id)
+	for _, t := range w.troubles.Open() {
+		if t.Source == string(id) {
+			w.clearTrouble(t.Type, t.Source)
+		}
+	}
+}
+
+// deactivateForgotten stops the connector from handling a forgotten device. Connectors report the availability of
+// deactivated devices synchronously, so it is called without the lock.
+func (w *Waechter) deactivateForgotten(id device.Id) {
+	if c := w.DeviceConnectorForId(id.Prefix()); c != nil {
+		_ = c.DeactivateDevice(id)
+	}
+}
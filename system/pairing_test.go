@@ -0,0 +1,161 @@
+package system
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/arm"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+)
+
+const testConfig = `
+persons:
+  - name: John Doe
+    pin: "1111"
+    admin: true
+zones:
+  - id: lr
+    displayName: Living Room
+`
+
+// testPairingConnector lists its devices by name and renames and removes them like Zigbee2Mqtt.
+type testPairingConnector struct {
+	DeviceConnector
+	devices     map[string]string // friendly name -> IEEE address
+	deactivated []device.Id
+}
+
+func (c *testPairingConnector) Id() string          { return "z2m" }
+func (c *testPairingConnector) DisplayName() string { return "Zigbee2Mqtt" }
+
+func (c *testPairingConnector) EnumerateDevices() []device.Spec {
+	var result []device.Spec
+	for name, ieeeAddress := range c.devices {
+		result = append(result, device.Spec{Id: device.NewId(c.Id(), name), DisplayName: name, IeeeAddress: ieeeAddress, Sensors: []device.Sensor{device.MotionSensor}})
+	}
+	return result
+}
+
+func (c *testPairingConnector) ActivateDevice(device.Id) error { return nil }
+
+func (c *testPairingConnector) DeactivateDevice(id device.Id) error {
+	c.deactivated = append(c.deactivated, id)
+	return nil
+}
+
+func (c *testPairingConnector) PermitJoin(time.Duration) error { return nil }
+
+func (c *testPairingConnector) RenameDevice(id device.Id, name string) error {
+	c.devices[name] = c.devices[id.Entity()]
+	delete(c.devices, id.Entity())
+	return nil
+}
+
+func (c *testPairingConnector) RemoveDevice(id device.Id) error {
+	delete(c.devices, id.Entity())
+	return nil
+}
+
+// initTestConfig loads testConfig from a temporary directory, which also takes the device registry.
+func initTestConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/config.yaml", []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	config.Init()
+}
+
+func TestAssignAndRemoveDevice(t *testing.T) {
+	initTestConfig(t)
+	const joined = device.Id("z2m::0x00158d0001a2b3c4")
+	const named = device.Id("z2m::Hall Motion")
+
+	tests := []struct {
+		name            string
+		change          func(w *Waechter) bool
+		wantDevices     []device.Id
+		wantDeactivated []device.Id
+		wantRegistry    []device.Id
+	}{
+		{
+			name:            "rename",
+			change:          func(w *Waechter) bool { return w.AssignDevice("1111", joined, "Hall Motion", "lr") },
+			wantDevices:     []device.Id{systemDeviceId, named},
+			wantDeactivated: []device.Id{joined},
+			wantRegistry:    []device.Id{named},
+		},
+		{
+			name:         "assign without rename",
+			change:       func(w *Waechter) bool { return w.AssignDevice("1111", joined, "", "lr") },
+			wantDevices:  []device.Id{systemDeviceId, joined},
+			wantRegistry: []device.Id{joined},
+		},
+		{
+			name:            "remove",
+			change:          func(w *Waechter) bool { return w.RemoveDevice("1111", joined) },
+			wantDevices:     []device.Id{systemDeviceId},
+			wantDeactivated: []device.Id{joined},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &testPairingConnector{devices: map[string]string{joined.Entity(): "0x00158d0001a2b3c4"}}
+			w := &Waechter{
+				state:            State{ArmMode: arm.Disarmed},
+				noteMgr:          newNotificationManager(),
+				troubles:         trouble.NewList(),
+				registry:         &registry{entries: map[device.Id]*RegistryEntry{}},
+				debouncer:        newDebouncer(),
+				deviceConnectors: []DeviceConnector{c},
+			}
+			w.loadZones()
+			w.loadDevices()
+			w.DeviceListUpdated(c)
+			w.raiseTrouble(trouble.SupervisionLoss, string(joined))
+
+			if !tt.change(w) {
+				t.Fatal("change refused")
+			}
+			w.DeviceListUpdated(c)
+
+			var ids []device.Id
+			for id := range w.devices {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if !reflect.DeepEqual(ids, tt.wantDevices) {
+				t.Errorf("devices = %v, want %v", ids, tt.wantDevices)
+			}
+			if !reflect.DeepEqual(c.deactivated, tt.wantDeactivated) {
+				t.Errorf("deactivated = %v, want %v", c.deactivated, tt.wantDeactivated)
+			}
+			var registered []device.Id
+			for _, e := range w.registry.all() {
+				registered = append(registered, e.Id)
+				if e.AssignedZone != "lr" {
+					t.Errorf("zone of %s = %q, want lr", e.Id, e.AssignedZone)
+				}
+			}
+			if !reflect.DeepEqual(registered, tt.wantRegistry) {
+				t.Errorf("registry = %v, want %v", registered, tt.wantRegistry)
+			}
+			_, kept := w.devices[joined]
+			for _, tr := range w.troubles.Open() {
+				if (!kept && tr.Source == string(joined)) || tr.Type == trouble.DeviceMissing {
+					t.Errorf("unexpected trouble %s of %s", tr.Type, tr.Source)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+// ReconcileSensorValue is called by connectors with values fetched after a restart or reconnect. Changes are
+// evaluated as events that happened while Waechter or the connection was offline: they are reported if they
+// concern an armed zone, but they do not raise burglar alarms because it is unknown when they happened.
+func (w *Waechter) ReconcileSensorValue(id device.Id, sensor device.Sensor, value any) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	d, ok := w.devices[id]
+	if !ok {
+		return
+	}
+
+	oldValue := d.State[sensor]
+	if oldValue != nil && oldValue == value {
+		return
+	}
+	d.State[sensor] = value
+	device.DDebug(d).Str("sensor", string(sensor)).Interface("value", value).Msg("Reconciled sensor value")
+
+	switch value.(type) {
+	case device.BatteryLevelSensorValue, device.BatteryWarningSensorValue:
+		w.evaluateBattery(d)
+	case device.LinkQualitySensorValue:
+		w.evaluateLinkQuality(d)
+	case device.SmokeSensorValue:
+		// smoke reported now is burning now
+		if device.IsTriggered(value) {
+			w.smokeDetected(id)
+			return
+		}
+	}
+
+	z := w.zoneForDeviceId(id)
+	if z.Armed && device.IsTriggered(value) {
+		device.DError(d).Str("sensor", string(sensor)).Interface("value", value).Msg("! Discovered while offline")
+		w.noteMgr.NotifyDiscoveredWhileOffline(d.Spec, z, sensor)
+	}
+}
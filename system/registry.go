@@ -0,0 +1,324 @@
+package system
+
+import (
+	"encoding/json"
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"github.com/mtrossbach/waechter/system/zone"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+type RegistryEntry struct {
+	Id          device.Id `json:"id"`
+	IeeeAddress string    `json:"ieeeAddress,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Zone        zone.Id   `json:"zone"`
+	// AssignedZone is the zone assigned during pairing, it takes precedence over the zone rules
+	AssignedZone zone.Id `json:"assignedZone,omitempty"`
+	DisplayName  string  `json:"displayName,omitempty"`
+	Enabled      bool    `json:"enabled"`
+	Missing      bool    `json:"missing"`
+}
+
+// lastSeenInterval limits how often check-ins mark the registry dirty, it is persisted on every housekeeping tick
+// otherwise.
+const lastSeenInterval = 15 * time.Minute
+
+type registry struct {
+	mutex   sync.Mutex
+	entries map[device.Id]*RegistryEntry
+	dirty   bool
+}
+
+func registryFilename() string {
+	return path.Join(config.Dir(), "devices")
+}
+
+func loadRegistry() *registry {
+	r := &registry{entries: map[device.Id]*RegistryEntry{}}
+
+	filename := registryFilename()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Info().Str("filename", filename).Err(err).Msg("No device registry found, registering all devices")
+		return r
+	}
+
+	var entries []*RegistryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Error().Err(err).Msg("Could not unmarshal device registry")
+		return r
+	}
+	for _, e := range entries {
+		r.entries[e.Id] = e
+	}
+
+	log.Info().Str("filename", filename).Int("devices", len(entries)).Msg("Device registry loaded")
+	return r
+}
+
+func (r *registry) persist() error {
+	data, err := json.Marshal(r.all())
+	if err != nil {
+		log.Error().Err(err).Msg("Could not marshal device registry")
+		return err
+	}
+
+	if err := os.WriteFile(registryFilename(), data, 0644); err != nil {
+		log.Error().Err(err).Msg("Could not write device registry")
+		return err
+	}
+
+	r.mutex.Lock()
+	r.dirty = false
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *registry) all() []RegistryEntry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var result []RegistryEntry
+	for _, e := range r.entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+func (r *registry) get(id device.Id) (RegistryEntry, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, ok := r.entries[id]
+	if !ok {
+		return RegistryEntry{}, false
+	}
+	return *e, true
+}
+
+func (r *registry) seen(id device.Id, t time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if e, ok := r.entries[id]; ok && t.Sub(e.LastSeen) >= lastSeenInterval {
+		e.LastSeen = t
+		r.dirty = true
+	}
+}
+
+// registerDevice records a listed device in the registry and applies the friendly-name override. It flags devices
+// whose IEEE address changed under the same name and returns true for devices that newly joined. Devices of the
+// initial device list of a connector are registered silently.
+func (w *Waechter) registerDevice(spec device.Spec, initial bool) (device.Spec, bool) {
+	r := w.registry
+	now := time.Now()
+
+	r.mutex.Lock()
+	e, known := r.entries[spec.Id]
+	former := r.migrate(spec)
+	if !known && len(former) > 0 {
+		e, known = r.entries[spec.Id], true
+	}
+	if !known {
+		e = &RegistryEntry{Id: spec.Id, FirstSeen: now, Enabled: true}
+		r.entries[spec.Id] = e
+	}
+	oldIeeeAddress := e.IeeeAddress
+	wasMissing := e.Missing
+	e.IeeeAddress = spec.IeeeAddress
+	e.Model = spec.Model
+	e.LastSeen = now
+	e.Missing = false
+	if len(e.DisplayName) > 0 {
+		spec.DisplayName = e.DisplayName
+	}
+	r.dirty = true
+	r.mutex.Unlock()
+
+	if len(former) > 0 {
+		log.Info().Str("id", string(spec.Id)).Str("former", string(former)).Msg("Device registry entry moved to the new id")
+	}
+	if !known {
+		log.Info().Str("id", string(spec.Id)).Str("ieeeAddress", spec.IeeeAddress).Str("model", spec.Model).Msg("New device registered")
+	}
+	if known && len(oldIeeeAddress) > 0 && len(spec.IeeeAddress) > 0 && oldIeeeAddress != spec.IeeeAddress {
+		log.Error().Str("id", string(spec.Id)).Str("old", oldIeeeAddress).Str("new", spec.IeeeAddress).Msg("! IEEE address changed, possible device substitution!")
+		w.raiseTrouble(trouble.DeviceSubstitution, string(spec.Id))
+	}
+	if wasMissing {
+		log.Info().Str("id", string(spec.Id)).Msg("Missing device is listed again")
+		w.clearTrouble(trouble.DeviceMissing, string(spec.Id))
+	}
+	return spec, !known && !initial
+}
+
+// migrate removes the entries of the former ids of a device. The first of them moves to the id of the device if
+// it has no entry yet, its former id is returned then. The caller holds the mutex.
+func (r *registry) migrate(spec device.Spec) device.Id {
+	var result device.Id
+	for _, former := range spec.FormerIds {
+		e, ok := r.entries[former]
+		if !ok {
+			continue
+		}
+		delete(r.entries, former)
+		r.dirty = true
+		if _, exists := r.entries[spec.Id]; !exists {
+			e.Id = spec.Id
+			r.entries[spec.Id] = e
+			result = former
+		}
+	}
+	return result
+}
+
+// knowsConnector returns true if any device of the connector is registered.
+func (r *registry) knowsConnector(connectorId string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id := range r.entries {
+		if id.Prefix() == connectorId {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMissingDevices raises a trouble for every known device of the connector that is not in its device list anymore.
+func (w *Waechter) checkMissingDevices(connectorId string, listed map[device.Id]bool) {
+	r := w.registry
+	var missing []device.Id
+
+	r.mutex.Lock()
+	for id, e := range r.entries {
+		if id.Prefix() != connectorId || listed[id] || e.Missing || !e.Enabled {
+			continue
+		}
+		e.Missing = true
+		r.dirty = true
+		missing = append(missing, id)
+	}
+	r.mutex.Unlock()
+
+	for _, id := range missing {
+		log.Error().Str("id", string(id)).Msg("! Known device disappeared from the device list!")
+		w.raiseTrouble(trouble.DeviceMissing, string(id))
+	}
+}
+
+// updateRegistryZone records the zone assigned to a device.
+func (w *Waechter) updateRegistryZone(id device.Id, z zone.Id) {
+	r := w.registry
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if e, ok := r.entries[id]; ok && e.Zone != z {
+		e.Zone = z
+		r.dirty = true
+	}
+}
+
+// rename moves the entry of a renamed device to its new id.
+func (r *registry) rename(old device.Id, new device.Id) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if e, ok := r.entries[old]; ok {
+		delete(r.entries, old)
+		e.Id = new
+		r.entries[new] = e
+		r.dirty = true
+	}
+}
+
+func (r *registry) assignZone(id device.Id, z zone.Id) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if e, ok := r.entries[id]; ok {
+		e.AssignedZone = z
+		r.dirty = true
+	}
+}
+
+func (r *registry) remove(id device.Id) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.entries, id)
+	r.dirty = true
+}
+
+func (w *Waechter) deviceEnabled(id device.Id) bool {
+	e, ok := w.registry.get(id)
+	return !ok || e.Enabled
+}
+
+func (w *Waechter) persistRegistry() {
+	r := w.registry
+	r.mutex.Lock()
+	dirty := r.dirty
+	r.mutex.Unlock()
+
+	if dirty {
+		err := r.persist()
+		w.updateTrouble(trouble.PersistenceFailure, "registry", err != nil)
+	}
+}
+
+func (w *Waechter) DeviceRegistry() []RegistryEntry {
+	return w.registry.all()
+}
+
+// UpdateDeviceRegistry changes the friendly-name override and the enabled state of a known device.
+func (w *Waechter) UpdateDeviceRegistry(pin string, id device.Id, displayName string, enabled bool) bool {
+	w.mutex.Lock()
+	person := w.checkAdminPin(systemDeviceId, pin)
+	if person == nil {
+		w.mutex.Unlock()
+		return false
+	}
+
+	r := w.registry
+	r.mutex.Lock()
+	e, ok := r.entries[id]
+	if ok {
+		e.DisplayName = displayName
+		e.Enabled = enabled
+		r.dirty = true
+	}
+	r.mutex.Unlock()
+	if !ok {
+		w.mutex.Unlock()
+		return false
+	}
+
+	log.Info().Str("name", person.Name).Str("id", string(id)).Str("displayName", displayName).Bool("enabled", enabled).Msg("Device registry entry updated")
+	w.persistRegistry()
+
+	_, active := w.devices[id]
+	if !enabled {
+		delete(w.devices, id)
+	}
+	w.mutex.Unlock()
+
+	// connectors report the availability of deactivated devices synchronously, so they are called without the lock
+	if c := w.DeviceConnectorForId(id.Prefix()); c != nil {
+		if !enabled && active {
+			_ = c.DeactivateDevice(id)
+		}
+		w.DeviceListUpdated(c)
+	}
+	return true
+}
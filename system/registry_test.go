@@ -0,0 +1,61 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+)
+
+func TestRegistryMigrate(t *testing.T) {
+	spec := device.Spec{Id: "ha::hall_motion_sensor", FormerIds: []device.Id{"ha::binary_sensor.hall_motion", "ha::binary_sensor.hall_tamper"}}
+
+	tests := []struct {
+		name       string
+		entries    []RegistryEntry
+		wantFormer device.Id
+		wantZone   zone.Id
+		wantIds    []device.Id
+	}{
+		{name: "nothing to migrate", entries: []RegistryEntry{{Id: "ha::kitchen"}}, wantIds: []device.Id{"ha::kitchen"}},
+		{name: "former entry moves", entries: []RegistryEntry{{Id: "ha::binary_sensor.hall_motion", AssignedZone: "hall"}},
+			wantFormer: "ha::binary_sensor.hall_motion", wantZone: "hall", wantIds: []device.Id{"ha::hall_motion_sensor"}},
+		{name: "first former entry wins, others are removed",
+			entries: []RegistryEntry{
+				{Id: "ha::binary_sensor.hall_tamper", AssignedZone: "cellar"},
+				{Id: "ha::binary_sensor.hall_motion", AssignedZone: "hall"},
+			},
+			wantFormer: "ha::binary_sensor.hall_motion", wantZone: "hall", wantIds: []device.Id{"ha::hall_motion_sensor"}},
+		{name: "existing entry is kept",
+			entries: []RegistryEntry{
+				{Id: "ha::hall_motion_sensor", AssignedZone: "office"},
+				{Id: "ha::binary_sensor.hall_motion", AssignedZone: "hall"},
+			},
+			wantZone: "office", wantIds: []device.Id{"ha::hall_motion_sensor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &registry{entries: map[device.Id]*RegistryEntry{}}
+			for i := range tt.entries {
+				e := tt.entries[i]
+				r.entries[e.Id] = &e
+			}
+
+			if got := r.migrate(spec); got != tt.wantFormer {
+				t.Errorf("migrate() = %q, want %q", got, tt.wantFormer)
+			}
+			if e, ok := r.entries[spec.Id]; ok && (e.AssignedZone != tt.wantZone || e.Id != spec.Id) {
+				t.Errorf("entry = %+v, want zone %q", *e, tt.wantZone)
+			}
+			var ids []device.Id
+			for _, e := range r.all() {
+				ids = append(ids, e.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIds)
+			}
+		})
+	}
+}
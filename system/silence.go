@@ -0,0 +1,84 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+func (w *Waechter) alarmSounding() bool {
+	return w.state.Alarm != alarm.None && !w.state.Alarm.IsPending()
+}
+
+// silence stops sirens and escalation but keeps the alarm latched and the system armed.
+func (w *Waechter) silence(id device.Id, enteredPin string) bool {
+	person := w.checkPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	if !w.alarmSounding() || w.state.Silenced {
+		return false
+	}
+
+	log.Info().Str("name", person.Name).Str("alarm", string(w.state.Alarm)).Msg("Alarm silenced by pin")
+	w.stopEntryTimers()
+	w.setSilenced(true)
+	w.checkFireCleared()
+	return true
+}
+
+// resetAlarm clears a latched alarm once its cause is resolved. The arm mode is not changed.
+func (w *Waechter) resetAlarm(id device.Id, enteredPin string) bool {
+	person := w.checkPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	if w.state.Alarm == alarm.None {
+		return false
+	}
+	if w.state.Alarm == alarm.Fire && len(w.DetectingSmokeSensors()) > 0 {
+		log.Warn().Str("name", person.Name).Msg("Could not reset fire alarm, smoke is still detected")
+		return false
+	}
+
+	log.Info().Str("name", person.Name).Str("alarm", string(w.state.Alarm)).Msg("Alarm reset by pin")
+	w.noteMgr.NotifyRecovery(w.specForDeviceId(id), w.zoneForDeviceId(id))
+	w.stopEntryTimers()
+	w.stopFireVerification()
+	w.setAlarm(alarm.None)
+	return true
+}
+
+func (w *Waechter) setSilenced(silenced bool) {
+	if w.state.Silenced != silenced {
+		w.state.Silenced = silenced
+
+		w.updateActors(device.StateActor, w.state.stateActorPayload())
+		w.updateActors(device.AlarmActor, w.state.alarmActorPayload())
+
+		log.Info().Bool("silenced", silenced).Msg("➔ Alarm silence changed")
+		w.persistState()
+	}
+}
+
+func (w *Waechter) DetectingSmokeSensors() []*device.Device {
+	var result []*device.Device
+	for _, d := range w.devices {
+		if v, ok := d.State[device.SmokeSensor].(device.SmokeSensorValue); ok && v.Smoke {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func (w *Waechter) SilenceAlarm(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.silence(systemDeviceId, pin)
+}
+
+func (w *Waechter) ResetAlarm(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.resetAlarm(systemDeviceId, pin)
+}
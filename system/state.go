@@ -7,16 +7,20 @@ import (
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/arm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
 	"os"
 	"path"
 	"time"
 )
 
 type State struct {
-	ArmMode        arm.Mode   `json:"armMode"`
-	Alarm          alarm.Type `json:"alarm"`
-	ArmModeUpdated time.Time  `json:"ArmModeUpdated"`
-	BdSeq          int        `json:"bdSeq"`
+	ArmMode        arm.Mode           `json:"armMode"`
+	Alarm          alarm.Type         `json:"alarm"`
+	ArmModeUpdated time.Time          `json:"ArmModeUpdated"`
+	Silenced       bool               `json:"silenced"`
+	AlarmMemory    []AlarmMemoryEntry `json:"alarmMemory"`
+	BdSeq          int                `json:"bdSeq"`
+	Bypassed       []zone.Id          `json:"bypassed,omitempty"`
 }
 
 func LoadState() State {
@@ -44,19 +48,20 @@ func LoadState() State {
 	return state
 }
 
-func PersistState(state State) {
+func PersistState(state State) error {
 	data, err := json.Marshal(state)
 	if err != nil {
 		log.Error().Err(err).Msg("Could not marshal state")
-		return
+		return err
 	}
 
 	filename := path.Join(config.Dir(), "state")
 	err = os.WriteFile(filename, data, 0644)
 	if err != nil {
 		log.Error().Err(err).Msg("Could not write state file")
-		return
+		return err
 	}
+	return nil
 }
 
 func (s State) Armed() bool {
@@ -65,11 +70,12 @@ func (s State) Armed() bool {
 
 func (s State) stateActorPayload() device.StateActorPayload {
 	return device.StateActorPayload{
-		ArmMode: s.ArmMode,
-		Alarm:   s.Alarm,
+		ArmMode:  s.ArmMode,
+		Alarm:    s.Alarm,
+		Silenced: s.Silenced,
 	}
 }
 
 func (s State) alarmActorPayload() device.AlarmActorPayload {
-	return device.AlarmActorPayload{Alarm: s.Alarm}
+	return device.AlarmActorPayload{Alarm: s.Alarm, Silenced: s.Silenced}
 }
@@ -0,0 +1,109 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/alarm"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"github.com/mtrossbach/waechter/system/zone"
+	"time"
+)
+
+type DeviceStatus struct {
+	Id                device.Id      `json:"id"`
+	DisplayName       string         `json:"displayName"`
+	Zone              zone.Id        `json:"zone"`
+	Active            bool           `json:"active"`
+	LastSeen          time.Time      `json:"lastSeen"`
+	SupervisionWindow time.Duration  `json:"supervisionWindow"`
+	SupervisionLost   bool           `json:"supervisionLost"`
+	Suppressed        map[string]int `json:"suppressed,omitempty"`
+}
+
+// supervisionWindow returns the shortest check-in window configured for any of the sensors of the device,
+// or 0 if the device is not supervised at all.
+func supervisionWindow(spec device.Spec) time.Duration {
+	var window time.Duration
+	for _, s := range spec.BaseSensors() {
+		if secs, ok := config.Supervision().Windows[string(s)]; ok && secs > 0 {
+			sw := time.Duration(secs) * time.Second
+			if window == 0 || sw < window {
+				window = sw
+			}
+		}
+	}
+	return window
+}
+
+func (w *Waechter) checkSupervision() {
+	now := time.Now()
+	for _, d := range w.devices {
+		window := supervisionWindow(d.Spec)
+		if window == 0 || d.Id.Prefix() == virtualPrefix || d.SupervisionLost || w.inMaintenance(d.Id) {
+			continue
+		}
+
+		// devices that have not reported since startup get a full window starting with the startup time
+		lastSeen := d.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = w.started
+		}
+		if now.Sub(lastSeen) < window {
+			continue
+		}
+
+		d.SupervisionLost = true
+		device.DError(d).Time("lastSeen", d.LastSeen).Dur("window", window).Msg("Device missed its check-in, supervision lost")
+		w.raiseTrouble(trouble.SupervisionLoss, string(d.Id))
+		if w.zoneForDeviceId(d.Id).Armed {
+			w.alarm(d.Id, alarm.Tamper, false)
+		}
+	}
+}
+
+func (w *Waechter) DeviceSeen(id device.Id) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	d, ok := w.devices[id]
+	if !ok {
+		return
+	}
+
+	d.LastSeen = time.Now()
+	w.registry.seen(id, d.LastSeen)
+	if d.SupervisionLost {
+		d.SupervisionLost = false
+		device.DInfo(d).Msg("Device checked in again, supervision restored")
+		w.clearTrouble(trouble.SupervisionLoss, string(id))
+	}
+}
+
+func (w *Waechter) DeviceStatuses() []DeviceStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var result []DeviceStatus
+	for _, d := range w.devices {
+		result = append(result, DeviceStatus{
+			Id:                d.Id,
+			DisplayName:       d.Spec.HumanReadableName(),
+			Zone:              d.Zone,
+			Active:            d.Active,
+			LastSeen:          d.LastSeen,
+			SupervisionWindow: supervisionWindow(d.Spec),
+			SupervisionLost:   d.SupervisionLost,
+			Suppressed:        suppressedCounters(d),
+		})
+	}
+	return result
+}
+
+func suppressedCounters(d *device.Device) map[string]int {
+	if len(d.Suppressed) == 0 {
+		return nil
+	}
+	result := map[string]int{}
+	for sensor, count := range d.Suppressed {
+		result[string(sensor)] = count
+	}
+	return result
+}
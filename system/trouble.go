@@ -0,0 +1,160 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"time"
+)
+
+const (
+	clockTolerance = time.Minute
+	clockMinYear   = 2020
+)
+
+// troubleSource returns the spec used to notify about a trouble. Sources that are not devices (connectors,
+// the state file, ...) are wrapped in a spec carrying just their name.
+func (w *Waechter) troubleSource(source string) device.Spec {
+	if d, ok := w.devices[device.Id(source)]; ok {
+		return d.Spec
+	}
+	return device.Spec{Id: device.Id(source), DisplayName: source}
+}
+
+func (w *Waechter) raiseTrouble(t trouble.Type, source string) {
+	tr, raised := w.troubles.Raise(t, source)
+	if !raised {
+		return
+	}
+	log.Warn().Str("trouble", string(t)).Str("source", source).Msg("Trouble raised")
+	w.noteMgr.NotifyTrouble(tr, w.troubleSource(source), w.zoneForDeviceId(device.Id(source)))
+}
+
+func (w *Waechter) clearTrouble(t trouble.Type, source string) {
+	tr, cleared := w.troubles.Clear(t, source)
+	if !cleared {
+		return
+	}
+	log.Info().Str("trouble", string(t)).Str("source", source).Msg("Trouble cleared")
+	w.noteMgr.NotifyTroubleCleared(tr, w.troubleSource(source), w.zoneForDeviceId(device.Id(source)))
+}
+
+func (w *Waechter) updateTrouble(t trouble.Type, source string, active bool) {
+	if active {
+		w.raiseTrouble(t, source)
+	} else {
+		w.clearTrouble(t, source)
+	}
+}
+
+func (w *Waechter) Troubles() []trouble.Trouble {
+	return w.troubles.All()
+}
+
+func (w *Waechter) AcknowledgeTroubles(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.acknowledge(systemDeviceId, pin)
+}
+
+func (w *Waechter) acknowledge(id device.Id, enteredPin string) bool {
+	person := w.checkPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	w.acknowledgeTroubles(person.Name)
+	return true
+}
+
+// detectionTroubles keep devices from detecting intrusions, by default only these block arming.
+var detectionTroubles = []trouble.Type{trouble.SupervisionLoss, trouble.ConnectorOffline, trouble.UnassignedDevice, trouble.DeviceMissing, trouble.DeviceSubstitution}
+
+func blocksArming(t trouble.Type) bool {
+	if types := config.General().ArmBlockingTroubles; types != nil {
+		return wslice.Contains(types, string(t))
+	}
+	return wslice.Contains(detectionTroubles, t)
+}
+
+// armBlockingTroubles returns the open troubles that have to be acknowledged before the system can be armed.
+func (w *Waechter) armBlockingTroubles() []trouble.Trouble {
+	var result []trouble.Trouble
+	for _, t := range w.troubles.Open() {
+		if !t.Acknowledged && blocksArming(t.Type) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (w *Waechter) acknowledgeTroubles(name string) {
+	if count := w.troubles.Acknowledge(); count > 0 {
+		log.Info().Str("name", name).Int("count", count).Msg("Troubles acknowledged")
+	}
+}
+
+// evaluateBattery combines the battery warning flag and the battery level of a device into one trouble.
+func (w *Waechter) evaluateBattery(d *device.Device) {
+	low := false
+	if v, ok := d.State[device.BatteryWarningSensor].(device.BatteryWarningSensorValue); ok && v.BatteryWarning {
+		low = true
+	}
+	if v, ok := d.State[device.BatteryLevelSensor].(device.BatteryLevelSensorValue); ok && v.BatteryLevel/100 < config.General().BatteryThreshold {
+		low = true
+	}
+	w.updateTrouble(trouble.LowBattery, string(d.Id), low)
+}
+
+func (w *Waechter) evaluateLinkQuality(d *device.Device) {
+	if v, ok := d.State[device.LinkQualitySensor].(device.LinkQualitySensorValue); ok {
+		w.updateTrouble(trouble.PoorSignal, string(d.Id), v.LinkQuality/255 < config.General().LinkQualityThreshold)
+	}
+}
+
+// checkClock detects an unset clock and jumps of the wall clock between two housekeeping runs.
+func (w *Waechter) checkClock(last time.Time, now time.Time) {
+	w.updateTrouble(trouble.Clock, "unset", now.Year() < clockMinYear)
+
+	drift := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > clockTolerance {
+		log.Warn().Dur("drift", drift).Msg("System clock jumped")
+	}
+	w.updateTrouble(trouble.Clock, "jump", drift > clockTolerance)
+}
+
+// troubleBeep reminds of unacknowledged troubles on keypads, sirens stay quiet.
+func (w *Waechter) troubleBeep() {
+	if w.state.Armed() || len(w.troubles.Unacknowledged()) == 0 {
+		return
+	}
+	for _, d := range w.devices {
+		if wslice.Contains(d.Spec.Actors, device.StateActor) {
+			w.updateActor(d.Id, device.NotificationShortActor, nil)
+		}
+	}
+}
+
+func (w *Waechter) notificationDelivered(ok bool) {
+	w.updateTrouble(trouble.NotificationFailure, "notification", !ok)
+}
+
+// ActorControlled is reported by connectors that control actors asynchronously, a failure raises a trouble
+// for the device until it can be controlled again.
+func (w *Waechter) ActorControlled(id device.Id, actor device.Actor, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err != nil {
+		log.Error().Err(err).Str("device", string(id)).Str("actor", string(actor)).Msg("Could not control actor")
+	}
+	w.updateTrouble(trouble.ActorFailure, string(id), err != nil)
+}
+
+func (w *Waechter) persistState() {
+	err := PersistState(w.state)
+	w.updateTrouble(trouble.PersistenceFailure, "state", err != nil)
+}
@@ -0,0 +1,145 @@
+package trouble
+
+import (
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	LowBattery          Type = "low-battery"
+	PoorSignal          Type = "poor-signal"
+	SupervisionLoss     Type = "supervision-loss"
+	ConnectorOffline    Type = "connector-offline"
+	NotificationFailure Type = "notification-failure"
+	PersistenceFailure  Type = "persistence-failure"
+	Clock               Type = "clock"
+	UnassignedDevice    Type = "unassigned-device"
+	DeviceMissing       Type = "device-missing"
+	DeviceSubstitution  Type = "device-substitution"
+	ActorFailure        Type = "actor-failure"
+)
+
+type Trouble struct {
+	Type         Type       `json:"type"`
+	Source       string     `json:"source"`
+	Since        time.Time  `json:"since"`
+	Acknowledged bool       `json:"acknowledged"`
+	Cleared      *time.Time `json:"cleared,omitempty"`
+}
+
+func (t Trouble) Open() bool {
+	return t.Cleared == nil
+}
+
+// List holds all open troubles and all cleared troubles that have not been acknowledged yet.
+type List struct {
+	mutex    sync.Mutex
+	troubles []*Trouble
+}
+
+func NewList() *List {
+	return &List{troubles: []*Trouble{}}
+}
+
+func (l *List) find(t Type, source string) *Trouble {
+	for _, e := range l.troubles {
+		if e.Type == t && e.Source == source {
+			return e
+		}
+	}
+	return nil
+}
+
+// Raise opens a trouble and reports whether it was not open before.
+func (l *List) Raise(t Type, source string) (Trouble, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e := l.find(t, source)
+	if e != nil && e.Open() {
+		return *e, false
+	}
+	if e == nil {
+		e = &Trouble{Type: t, Source: source}
+		l.troubles = append(l.troubles, e)
+	}
+	e.Since = time.Now()
+	e.Acknowledged = false
+	e.Cleared = nil
+	return *e, true
+}
+
+// Clear closes an open trouble and reports whether it was open before. Cleared troubles stay in the list
+// until they have been acknowledged.
+func (l *List) Clear(t Type, source string) (Trouble, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e := l.find(t, source)
+	if e == nil || !e.Open() {
+		return Trouble{}, false
+	}
+	now := time.Now()
+	e.Cleared = &now
+	if e.Acknowledged {
+		l.remove(e)
+	}
+	return *e, true
+}
+
+// Acknowledge marks all troubles as acknowledged and drops the ones that are already cleared.
+func (l *List) Acknowledge() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count := 0
+	for _, e := range l.troubles {
+		if !e.Acknowledged {
+			e.Acknowledged = true
+			count++
+		}
+	}
+	for _, e := range l.troubles {
+		if !e.Open() {
+			l.remove(e)
+		}
+	}
+	return count
+}
+
+func (l *List) remove(e *Trouble) {
+	result := make([]*Trouble, 0, len(l.troubles))
+	for _, t := range l.troubles {
+		if t != e {
+			result = append(result, t)
+		}
+	}
+	l.troubles = result
+}
+
+func (l *List) filter(f func(t Trouble) bool) []Trouble {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := []Trouble{}
+	for _, e := range l.troubles {
+		if f(*e) {
+			result = append(result, *e)
+		}
+	}
+	return result
+}
+
+func (l *List) All() []Trouble {
+	return l.filter(func(t Trouble) bool { return true })
+}
+
+func (l *List) Open() []Trouble {
+	return l.filter(func(t Trouble) bool { return t.Open() })
+}
+
+func (l *List) Unacknowledged() []Trouble {
+	return l.filter(func(t Trouble) bool { return !t.Acknowledged })
+}
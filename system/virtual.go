@@ -0,0 +1,190 @@
+package system
+
+import (
+	"fmt"
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+	"strings"
+	"sync"
+	"time"
+)
+
+const virtualPrefix = "virtual"
+
+// virtualSensors are the sensors of real devices that are consumed by virtual devices. Their values are only
+// evaluated through the virtual device and never raise alarms on their own.
+var virtualSensors = []device.Sensor{device.MotionSensor, device.ContactSensor, device.VibrationSensor, device.LockSensor}
+
+type virtualInput struct {
+	device    device.Id
+	sensor    device.Sensor
+	triggered time.Time
+}
+
+type virtualDevice struct {
+	mutex    sync.Mutex
+	id       device.Id
+	sensor   device.Sensor
+	required int
+	window   time.Duration
+	inputs   []*virtualInput
+}
+
+func (w *Waechter) loadVirtualDevices() {
+	for _, vc := range config.VirtualDevices() {
+		vd, err := newVirtualDevice(vc)
+		if err != nil {
+			log.Error().Err(err).Str("id", vc.Id).Msg("Could not create virtual device")
+			continue
+		}
+
+		var inputs []string
+		for _, in := range vd.inputs {
+			inputs = append(inputs, string(in.device))
+		}
+		w.devices[vd.id] = &device.Device{
+			Id:     vd.id,
+			Zone:   zone.Id(vc.Zone),
+			Active: true,
+			Spec: device.Spec{
+				Id:          vd.id,
+				DisplayName: vc.Name,
+				Vendor:      "Wächter",
+				Model:       "virtual",
+				Description: fmt.Sprintf("%d of %s", vd.required, strings.Join(inputs, ", ")),
+				Sensors:     []device.Sensor{vd.sensor},
+			},
+			State: map[device.Sensor]any{},
+		}
+		if vc.Zone == "" {
+			w.updateZone(w.devices[vd.id])
+		} else {
+			w.checkZone(w.devices[vd.id])
+		}
+		w.virtualDevices = append(w.virtualDevices, vd)
+		device.DInfo(w.devices[vd.id]).Int("required", vd.required).Strs("inputs", inputs).Msg("Virtual device created")
+	}
+}
+
+func newVirtualDevice(vc config.VirtualDeviceConfig) (*virtualDevice, error) {
+	if len(vc.Inputs) == 0 {
+		return nil, fmt.Errorf("no inputs")
+	}
+
+	sensor := device.Sensor(vc.Sensor)
+	switch sensor {
+	case "":
+		sensor = device.MotionSensor
+	case device.MotionSensor, device.ContactSensor, device.VibrationSensor, device.SmokeSensor:
+	default:
+		return nil, fmt.Errorf("unsupported sensor %s", vc.Sensor)
+	}
+
+	vd := &virtualDevice{
+		id:     device.NewId(virtualPrefix, vc.Id),
+		sensor: sensor,
+		window: time.Duration(vc.Window) * time.Second,
+	}
+	for _, ic := range vc.Inputs {
+		vd.inputs = append(vd.inputs, &virtualInput{device: device.Id(ic.Device), sensor: device.Sensor(ic.Sensor)})
+	}
+
+	switch vc.Logic {
+	case "", "or":
+		vd.required = 1
+	case "and":
+		vd.required = len(vd.inputs)
+	case "k-of-n":
+		if vc.Count < 1 || vc.Count > len(vd.inputs) {
+			return nil, fmt.Errorf("count %d out of range", vc.Count)
+		}
+		vd.required = vc.Count
+	default:
+		return nil, fmt.Errorf("unsupported logic %s", vc.Logic)
+	}
+	return vd, nil
+}
+
+func (in *virtualInput) matches(id device.Id, sensor device.Sensor) bool {
+	return in.device == id && (in.sensor == "" || in.sensor == sensor || in.sensor == sensor.Base())
+}
+
+// feedVirtualDevices passes a sensor value to all virtual devices using it as input. It returns true if the
+// value is consumed by a virtual device and must not be evaluated on its own.
+func (w *Waechter) feedVirtualDevices(id device.Id, sensor device.Sensor, value any) bool {
+	consumed := false
+	for _, vd := range w.virtualDevices {
+		fed := false
+		vd.mutex.Lock()
+		for _, in := range vd.inputs {
+			if !in.matches(id, sensor) {
+				continue
+			}
+			fed = true
+			if device.IsTriggered(value) {
+				in.triggered = time.Now()
+			}
+		}
+		vd.mutex.Unlock()
+
+		if !fed {
+			continue
+		}
+		for _, s := range virtualSensors {
+			if s == sensor.Base() {
+				consumed = true
+			}
+		}
+		w.evaluateVirtualDevice(vd)
+		if vd.window > 0 && device.IsTriggered(value) {
+			time.AfterFunc(vd.window, func() { w.locked(func() { w.evaluateVirtualDevice(vd) }) })
+		}
+	}
+	return consumed
+}
+
+// evaluateVirtualDevice counts the inputs that are triggered right now or were triggered within the time window
+// and delivers the result as sensor value of the virtual device.
+func (w *Waechter) evaluateVirtualDevice(vd *virtualDevice) {
+	now := time.Now()
+	active := 0
+
+	vd.mutex.Lock()
+	for _, in := range vd.inputs {
+		if vd.window > 0 && !in.triggered.IsZero() && now.Sub(in.triggered) < vd.window {
+			active++
+		} else if w.inputTriggered(in) {
+			active++
+		}
+	}
+	vd.mutex.Unlock()
+
+	triggered := active >= vd.required
+	var value any
+	switch vd.sensor {
+	case device.ContactSensor:
+		value = device.ContactSensorValue{Contact: !triggered}
+	case device.VibrationSensor:
+		value = device.VibrationSensorValue{Vibration: triggered}
+	case device.SmokeSensor:
+		value = device.SmokeSensorValue{Smoke: triggered}
+	default:
+		value = device.MotionSensorValue{Motion: triggered}
+	}
+	w.deliverSensorValue(vd.id, vd.sensor, value)
+}
+
+func (w *Waechter) inputTriggered(in *virtualInput) bool {
+	d, ok := w.devices[in.device]
+	if !ok {
+		return false
+	}
+	for sensor, value := range d.State {
+		if in.matches(d.Id, sensor) && device.IsTriggered(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/mtrossbach/waechter/system/alarm"
 	"github.com/mtrossbach/waechter/system/arm"
 	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
 	"github.com/mtrossbach/waechter/system/zone"
 	"golang.org/x/exp/maps"
 	"sync"
@@ -22,6 +23,22 @@ type Waechter struct {
 	deviceConnectors []DeviceConnector
 	wrongPinCount    int
 	noteMgr          *notificationManager
+	troubles         *trouble.List
+	walkTest         *walkTest
+	maintenance      *maintenance
+	fireVerification *fireVerification
+	debouncer        *debouncer
+	registry         *registry
+	pairing          *pairing
+	virtualDevices   []*virtualDevice
+
+	lastWalkTestReport *WalkTestReport
+	started            time.Time
+
+	// mutex serializes event handling: connector callbacks, timers and API calls hold it while they work on
+	// devices, zones and state. It is released while activating and deactivating devices, connectors call
+	// back from there.
+	mutex sync.Mutex
 
 	entryTimers          sync.Map
 	unavailabilityTimers sync.Map
@@ -35,14 +52,25 @@ func NewWaechter() *Waechter {
 		wrongPinCount:        0,
 		deviceConnectors:     []DeviceConnector{},
 		noteMgr:              newNotificationManager(),
+		troubles:             trouble.NewList(),
+		registry:             loadRegistry(),
+		debouncer:            newDebouncer(),
+		started:              time.Now(),
 		entryTimers:          sync.Map{},
 		unavailabilityTimers: sync.Map{},
 	}
 
+	w.noteMgr.onDelivery = func(ok bool) {
+		w.locked(func() { w.notificationDelivered(ok) })
+	}
+
 	w.loadZones()
 	w.loadDevices()
+	w.loadVirtualDevices()
 	w.loadState()
 
+	go w.housekeeping()
+
 	/*
 		go func() {
 			scanner := bufio.NewScanner(os.Stdin)
@@ -80,6 +108,30 @@ func NewWaechter() *Waechter {
 	return &w
 }
 
+func (w *Waechter) housekeeping() {
+	interval := time.Duration(config.Supervision().CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	last := time.Now()
+	for now := range time.Tick(interval) {
+		w.mutex.Lock()
+		w.checkClock(last, now)
+		last = now
+		w.checkSupervision()
+		w.persistRegistry()
+		w.troubleBeep()
+		w.mutex.Unlock()
+	}
+}
+
+// locked runs f holding the event lock, for timers and goroutines.
+func (w *Waechter) locked(f func()) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	f()
+}
+
 func (w *Waechter) AddDeviceConnector(connector DeviceConnector) {
 	w.deviceConnectors = append(w.deviceConnectors, connector)
 	connector.Setup(w)
@@ -100,8 +152,12 @@ func (w *Waechter) AddNotificationAdapter(adapter NotificationAdapter) {
 
 func (w *Waechter) loadState() {
 	s := LoadState()
+	w.state.AlarmMemory = s.AlarmMemory
+	w.state.Bypassed = s.Bypassed
+	w.applyBypasses()
 	w.setAlarm(s.Alarm)
 	w.setArmMode(s.ArmMode)
+	w.state.Silenced = s.Silenced
 	w.state.ArmModeUpdated = s.ArmModeUpdated
 	w.state.BdSeq = s.BdSeq
 }
@@ -115,29 +171,28 @@ func (w *Waechter) loadZones() {
 }
 
 func (w *Waechter) loadDevices() {
+	// devices are added when discovered, config.Devices() only assigns their zones
 	w.devices = make(map[device.Id]*device.Device)
-	/*
-		// device list not from config file, by Jack Chen
-
-		for _, dc := range config.Devices() {
-			d := device.DeviceFromConfig(dc)
-			w.devices[d.Id] = &d
-		}
-
-	*/
 	w.devices[systemDeviceId] = systemDevice()
 }
 
 func (w *Waechter) zoneForDeviceId(id device.Id) zone.Zone {
-	z, ok := w.zones[w.devices[id].Zone]
-	if !ok {
+	d, ok := w.devices[id]
+	if !ok || id == systemDeviceId {
 		return zone.SubstitutionZone(w.name, w.state.Armed())
 	}
+	z, ok := w.zones[d.Zone]
+	if !ok {
+		return zone.UnassignedZone()
+	}
 	return *z
 }
 
 func (w *Waechter) DeviceConnectorForId(id string) DeviceConnector {
 	c, _ := wslice.FilterOne[DeviceConnector](w.deviceConnectors, func(i DeviceConnector) bool { return i.Id() == id })
+	if c == nil {
+		return nil
+	}
 	return *c
 }
 
@@ -150,6 +205,10 @@ func (w *Waechter) DeviceSensorValue(id device.Id, sensor device.Sensor) interfa
 		return v.Contact
 	} else if v, ok := value.(device.SmokeSensorValue); ok {
 		return v.Smoke
+	} else if v, ok := value.(device.VibrationSensorValue); ok {
+		return v.Vibration
+	} else if v, ok := value.(device.LockSensorValue); ok {
+		return v.Locked
 	} else if v, ok := value.(device.BatteryLevelSensorValue); ok {
 		return v.BatteryLevel
 	} else if v, ok := value.(device.LinkQualitySensorValue); ok {
@@ -164,8 +223,35 @@ func (w *Waechter) DeviceSensorValue(id device.Id, sensor device.Sensor) interfa
 }
 
 func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value any) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.deliverSensorValue(id, sensor, value)
+}
+
+func (w *Waechter) deliverSensorValue(id device.Id, sensor device.Sensor, value any) bool {
 	log.Debug().Str("id", string(id)).Str("sensor", string(sensor)).Msg("DeliverSensorValue")
 
+	if handled, ok := w.command(id, value); handled {
+		return ok
+	}
+
+	if _, ok := w.devices[id]; !ok {
+		log.Error().Str("device", string(id)).Interface("value", value).Msg("Sensor value received for unknown device")
+		return false
+	}
+
+	if w.inMaintenance(id) {
+		device.DInfo(w.devices[id]).Str("sensor", string(sensor)).Interface("value", value).Msg("Maintenance: sensor event")
+	}
+
+	if !w.debounce(id, sensor, value) {
+		return false
+	}
+	return w.processSensorValue(id, sensor, value)
+}
+
+// processSensorValue evaluates a sensor value that passed debouncing.
+func (w *Waechter) processSensorValue(id device.Id, sensor device.Sensor, value any) bool {
 	oldValue := w.devices[id].State[sensor]
 	w.devices[id].State[sensor] = value
 
@@ -173,11 +259,22 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 		return false
 	}
 
+	consumed := w.feedVirtualDevices(id, sensor, value)
+
+	if w.walkTestTrigger(id, value) {
+		return true
+	}
+	if consumed {
+		return true
+	}
+
 	z := w.zoneForDeviceId(id)
 
 	if v, ok := value.(device.MotionSensorValue); ok {
 		fmt.Printf("Motion Sensor %v\n", v.Motion)
-		w.noteMgr.NotifyMotionSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Motion)
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyMotionSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Motion)
+		}
 		if z.Armed && v.Motion {
 			if !(w.isDuringExitDelay()) {
 				w.alarm(id, alarm.Burglar, z.Delayed)
@@ -186,7 +283,9 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 
 	} else if v, ok := value.(device.ContactSensorValue); ok {
 		fmt.Printf("Contact Sensor %v\n", v.Contact)
-		w.noteMgr.NotifyContactSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Contact)
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyContactSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Contact)
+		}
 		if z.Armed && !v.Contact {
 			if !(w.isDuringExitDelay()) {
 				w.alarm(id, alarm.Burglar, z.Delayed)
@@ -195,9 +294,29 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 
 	} else if v, ok := value.(device.SmokeSensorValue); ok {
 		fmt.Printf("Smoke Sensor %v\n", v.Smoke)
-		w.noteMgr.NotifySmokeSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Smoke)
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifySmokeSensor(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Smoke)
+		}
 		if v.Smoke {
-			w.alarm(id, alarm.Fire, false)
+			w.smokeDetected(id)
+		} else {
+			w.checkFireCleared()
+		}
+
+	} else if v, ok := value.(device.VibrationSensorValue); ok {
+		log.Debug().Str("id", string(id)).Bool("vibration", v.Vibration).Msg("Vibration sensor")
+		if z.Armed && v.Vibration {
+			if !(w.isDuringExitDelay()) {
+				w.alarm(id, alarm.Burglar, z.Delayed)
+			}
+		}
+
+	} else if v, ok := value.(device.LockSensorValue); ok {
+		log.Debug().Str("id", string(id)).Bool("locked", v.Locked).Msg("Lock sensor")
+		if z.Armed && !v.Locked {
+			if !(w.isDuringExitDelay()) {
+				w.alarm(id, alarm.Burglar, z.Delayed)
+			}
 		}
 
 	} else if v, ok := value.(device.PanicSensorValue); ok {
@@ -208,13 +327,11 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 
 	} else if v, ok := value.(device.BatteryWarningSensorValue); ok {
 		fmt.Printf("Battery Low Warning %v\n", v.BatteryWarning)
-		if v.BatteryWarning {
-			w.noteMgr.NotifyBatteryLevel(w.specForDeviceId(id), w.zoneForDeviceId(id), 0)
-		}
+		w.evaluateBattery(w.devices[id])
 
 	} else if v, ok := value.(device.TamperSensorValues); ok {
 		fmt.Printf("Tamper Sensor %v\n", v.Tamper)
-		if v.Tamper {
+		if v.Tamper && !w.inMaintenance(id) {
 			if (z.Armed && config.General().TamperAlarmWhileArmed) || (!z.Armed && config.General().TamperAlarmWhileDisarmed) {
 				w.alarm(id, alarm.Tamper, false)
 			}
@@ -222,32 +339,29 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 
 	} else if v, ok := value.(device.BatteryLevelSensorValue); ok {
 		fmt.Printf("Battery Value %f\n", v.BatteryLevel)
-		//if v.BatteryLevel/100 < config.General().BatteryThreshold {
-		w.noteMgr.NotifyBatteryLevel(w.specForDeviceId(id), w.zoneForDeviceId(id), v.BatteryLevel)
-		//}
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyBatteryLevel(w.specForDeviceId(id), w.zoneForDeviceId(id), v.BatteryLevel)
+		}
+		w.evaluateBattery(w.devices[id])
 
 	} else if v, ok := value.(device.LinkQualitySensorValue); ok {
 		fmt.Printf("Link Quality Value %f\n", v.LinkQuality)
-		//if v.LinkQuality/255 < config.General().LinkQualityThreshold {
-		w.noteMgr.NotifyLinkQuality(w.specForDeviceId(id), w.zoneForDeviceId(id), v.LinkQuality)
-		//}
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyLinkQuality(w.specForDeviceId(id), w.zoneForDeviceId(id), v.LinkQuality)
+		}
+		w.evaluateLinkQuality(w.devices[id])
 
 	} else if v, ok := value.(device.HumiditySensorValue); ok {
 		fmt.Printf("Humidity Value %f\n", v.Humidity)
-		w.noteMgr.NotifyHumidityValue(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Humidity)
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyHumidityValue(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Humidity)
+		}
 
 	} else if v, ok := value.(device.TemperatureSensorValue); ok {
 		fmt.Printf("Temperature Value %f\n", v.Temperature)
-		w.noteMgr.NotifyTemperatureValue(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Temperature)
-
-	} else if v, ok := value.(device.ArmingSensorValue); ok {
-		if v.ArmMode == arm.Disarmed {
-			return false
+		if w.notificationDue(id, sensor, value) {
+			w.noteMgr.NotifyTemperatureValue(w.specForDeviceId(id), w.zoneForDeviceId(id), v.Temperature)
 		}
-		return w.arm(id, v.ArmMode)
-
-	} else if v, ok := value.(device.DisarmingSensorValue); ok {
-		return w.disarm(id, v.Pin)
 
 	} else {
 		log.Error().Str("device", string(id)).Interface("value", value).Msg("Unknown sensor value received")
@@ -257,6 +371,60 @@ func (w *Waechter) DeliverSensorValue(id device.Id, sensor device.Sensor, value
 	return true
 }
 
+// command handles sensor values that are commands rather than states. Commands are never deduplicated, entering
+// the same PIN twice must be processed twice.
+func (w *Waechter) command(id device.Id, value any) (bool, bool) {
+	if v, ok := value.(device.ArmingSensorValue); ok {
+		if v.ArmMode == arm.Disarmed {
+			return true, false
+		}
+		if v.PinRequired && w.checkPin(id, v.Pin) == nil {
+			return true, false
+		}
+		return true, w.arm(id, v.ArmMode)
+
+	} else if v, ok := value.(device.FireSensorValue); ok {
+		if !v.Fire {
+			return true, false
+		}
+		if w.walkTestTrigger(id, value) {
+			return true, true
+		}
+		log.Info().Str("device", string(id)).Msg("Manual fire alarm")
+		w.stopFireVerification()
+		w.alarm(id, alarm.Fire, false)
+		return true, true
+
+	} else if v, ok := value.(device.DisarmingSensorValue); ok {
+		if config.General().SilenceBeforeDisarm && w.alarmSounding() && !w.state.Silenced {
+			return true, w.silence(id, v.Pin)
+		}
+		return true, w.disarm(id, v.Pin)
+
+	} else if v, ok := value.(device.SilencingSensorValue); ok {
+		return true, w.silence(id, v.Pin)
+
+	} else if v, ok := value.(device.ResettingSensorValue); ok {
+		return true, w.resetAlarm(id, v.Pin)
+
+	} else if v, ok := value.(device.AcknowledgingSensorValue); ok {
+		return true, w.acknowledge(id, v.Pin)
+
+	} else if v, ok := value.(device.MaintenanceSensorValue); ok {
+		if w.maintenance != nil {
+			return true, w.stopMaintenance(id, v.Pin)
+		}
+		return true, w.startMaintenance(id, v.Pin, nil)
+
+	} else if v, ok := value.(device.WalkTestSensorValue); ok {
+		if w.walkTest != nil {
+			return true, w.stopWalkTest(id, v.Pin)
+		}
+		return true, w.startWalkTest(id, v.Pin)
+	}
+	return false, false
+}
+
 func (w *Waechter) isDuringExitDelay() bool {
 	exitDelay := time.Duration(config.General().ExitDelay) * time.Second
 	return w.state.Armed() && time.Now().Sub(w.state.ArmModeUpdated) < exitDelay
@@ -268,6 +436,8 @@ func (w *Waechter) alarm(id device.Id, alarmType alarm.Type, delayedZone bool) {
 		t, ok := w.entryTimers.Load(id)
 		if !ok {
 			t = time.AfterFunc(time.Duration(config.General().EntryDelay)*time.Second, func() {
+				w.mutex.Lock()
+				defer w.mutex.Unlock()
 				w.entryTimers.Delete(id)
 				if w.zoneForDeviceId(id).Armed {
 					w._alarm(id, alarmType)
@@ -290,8 +460,9 @@ func (w *Waechter) specForDeviceId(id device.Id) device.Spec {
 }
 
 func (w *Waechter) _alarm(id device.Id, a alarm.Type) {
+	w.rememberAlarm(id, a)
 	w.setAlarm(a)
-	if a != alarm.EntryDelay {
+	if !a.IsPending() {
 		w.noteMgr.NotifyAlarm(a, w.specForDeviceId(id), w.zoneForDeviceId(id))
 	}
 }
@@ -300,6 +471,24 @@ func (w *Waechter) arm(id device.Id, mode arm.Mode) bool {
 	if w.state.Armed() || mode == arm.Disarmed {
 		return false
 	}
+	if w.walkTest != nil {
+		log.Warn().Msg("! Walk test is running, not ready to arm!")
+		return false
+	}
+	if w.maintenance != nil {
+		log.Warn().Msg("! Maintenance mode is active, not ready to arm!")
+		return false
+	}
+	if w.pairing != nil {
+		log.Warn().Msg("! Pairing is active, not ready to arm!")
+		return false
+	}
+	if open := w.armBlockingTroubles(); len(open) > 0 {
+		for _, t := range open {
+			log.Warn().Str("trouble", string(t.Type)).Str("source", t.Source).Msg("! Trouble not acknowledged, not ready to arm!")
+		}
+		return false
+	}
 	if mode == arm.Disarmed {
 		mode = arm.All
 	}
@@ -353,33 +542,52 @@ func (w *Waechter) iterateDeviceStates(handler func(d *device.Device, sensor dev
 }
 
 func (w *Waechter) disarm(id device.Id, enteredPin string) bool {
+	person := w.checkPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+
+	if w.state.Alarm != alarm.None && !w.state.Alarm.IsPending() {
+		w.noteMgr.NotifyRecovery(w.specForDeviceId(id), w.zoneForDeviceId(id))
+	}
+	log.Info().Str("name", person.Name).Msg("Disarmed by pin")
+	period := w.state.ArmModeUpdated
+	w.acknowledgeTroubles(person.Name)
+	w.setAlarm(alarm.None)
+	w.setArmMode(arm.Disarmed)
+	w.stopEntryTimers()
+	w.stopFireVerification()
+	w.reportAlarmMemory(period)
+	return true
+}
+
+// checkPin returns the person the entered PIN belongs to. Wrong PINs are counted and raise a PIN tamper alarm
+// once the configured maximum is exceeded.
+func (w *Waechter) checkPin(id device.Id, enteredPin string) *config.Person {
 	persons := config.Persons()
 	person, _ := wslice.FilterOne(persons, func(p config.Person) bool { return p.Pin == enteredPin })
 
 	if person != nil {
 		w.wrongPinCount = 0
-		if w.state.Alarm != alarm.None && w.state.Alarm != alarm.EntryDelay {
-			w.noteMgr.NotifyRecovery(w.specForDeviceId(id), w.zoneForDeviceId(id))
-		}
-		log.Info().Str("name", person.Name).Msg("Disarmed by pin")
-		w.setAlarm(alarm.None)
-		w.setArmMode(arm.Disarmed)
-		w.entryTimers.Range(func(key, value any) bool {
-			t := value.(*time.Timer)
-			t.Stop()
-			w.entryTimers.Delete(key)
-			return true
-		})
-		return true
-	} else {
-		w.wrongPinCount += 1
-		log.Info().Str("device", string(id)).Int("wrongPinCount", w.wrongPinCount).Msg("Wrong PIN entered.")
-		if w.wrongPinCount > config.General().MaxWrongPinCount {
-			log.Info().Str("device", string(id)).Int("wrongPinCount", w.wrongPinCount).Msg("Maximum number of wrong PINs exceed.")
-			w.alarm(id, alarm.TamperPin, false)
-		}
-		return false
+		return person
 	}
+
+	w.wrongPinCount += 1
+	log.Info().Str("device", string(id)).Int("wrongPinCount", w.wrongPinCount).Msg("Wrong PIN entered.")
+	if w.wrongPinCount > config.General().MaxWrongPinCount {
+		log.Info().Str("device", string(id)).Int("wrongPinCount", w.wrongPinCount).Msg("Maximum number of wrong PINs exceed.")
+		w.alarm(id, alarm.TamperPin, false)
+	}
+	return nil
+}
+
+func (w *Waechter) stopEntryTimers() {
+	w.entryTimers.Range(func(key, value any) bool {
+		t := value.(*time.Timer)
+		t.Stop()
+		w.entryTimers.Delete(key)
+		return true
+	})
 }
 
 func (w *Waechter) SystemState() State {
@@ -390,16 +598,31 @@ func (w *Waechter) DeviceListUpdated(connector DeviceConnector) {
 	if connector == nil {
 		return
 	}
+	w.mutex.Lock()
 	deviceSpecs := connector.EnumerateDevices()
 	log.Info().Str("connector", connector.DisplayName()).Str("id", connector.Id()).Msg("Received new device list:")
+	listed := map[device.Id]bool{}
+	initial := !w.registry.knowsConnector(connector.Id())
 	for _, s := range deviceSpecs {
-		if ad, ok := w.devices[s.Id]; ok {
-			ad.Spec = s
-		} else {
+		listed[s.Id] = true
+		s, joined := w.registerDevice(s, initial)
+		if !w.deviceEnabled(s.Id) {
+			log.Info().Str("id", string(s.Id)).Msg("\t- Device disabled")
+			continue
+		}
+
+		d, ok := w.devices[s.Id]
+		if !ok {
 			// not existing device, new it, by Jack Chen
-			d := device.NewDevice(s.Id)
-			d.Spec = s
-			w.devices[d.Id] = &d
+			nd := device.NewDevice(s.Id)
+			d = &nd
+			w.devices[d.Id] = d
+		}
+		d.Spec = s
+		w.updateZone(d)
+		w.updateRegistryZone(d.Id, d.Zone)
+		if joined {
+			w.noteMgr.NotifyDeviceJoined(d.Spec, w.zoneForDeviceId(d.Id))
 		}
 		var sensors []string
 		var actors []string
@@ -411,24 +634,37 @@ func (w *Waechter) DeviceListUpdated(connector DeviceConnector) {
 		}
 		log.Info().Str("id", string(s.Id)).Str("displayName", s.DisplayName).Str("vendor", s.Vendor).Str("model", s.Model).Strs("sensors", sensors).Strs("actors", actors).Msg("\t- Device detected")
 	}
+	w.checkMissingDevices(connector.Id(), listed)
+	w.persistRegistry()
 
-	log.Info().Str("connector", connector.DisplayName()).Msg("Trying to activate devices")
+	var activate []*device.Device
 	for _, d := range w.devices {
-		if /*!d.Active &&*/ d.Id.Prefix() == connector.Id() {
-			err := connector.ActivateDevice(d.Id)
-			if err != nil {
-				device.DError(d).Err(err).Msg("✗ Could not activate device")
-			} else {
-				device.DInfo(d).Msg("✓ Device active")
-			}
+		if /*!d.Active &&*/ d.Id.Prefix() == connector.Id() && listed[d.Id] && w.deviceEnabled(d.Id) {
+			activate = append(activate, d)
+		}
+	}
+	w.mutex.Unlock()
+
+	log.Info().Str("connector", connector.DisplayName()).Msg("Trying to activate devices")
+	for _, d := range activate {
+		err := connector.ActivateDevice(d.Id)
+		if err != nil {
+			device.DError(d).Err(err).Msg("✗ Could not activate device")
+		} else {
+			device.DInfo(d).Msg("✓ Device active")
 		}
 	}
 	log.Info().Str("connector", connector.DisplayName()).Msg("Done with activating devices")
 }
 
 func (w *Waechter) OperationalStateChanged(connector DeviceConnector) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.updateTrouble(trouble.ConnectorOffline, connector.Id(), !connector.Operational())
 	if !connector.Operational() && config.General().DeviceSystemFaultAlarm && w.state.Armed() {
 		time.AfterFunc(time.Duration(config.General().DeviceSystemFaultAlarmDelay)*time.Second, func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
 			if !connector.Operational() && w.state.Armed() {
 				w.alarm(systemDeviceId, alarm.Tamper, false)
 			}
@@ -437,22 +673,25 @@ func (w *Waechter) OperationalStateChanged(connector DeviceConnector) {
 }
 
 func (w *Waechter) DeviceUnavailable(id device.Id) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	d, ok := w.devices[id]
-	if ok {
-		d.Active = false
-		w.noteMgr.NotifyDeviceUnAvailable(w.specForDeviceId(id), w.zoneForDeviceId(id))
+	if !ok {
+		// renamed, removed or disabled devices are reported by the connector when they are deactivated
+		return
 	}
+	d.Active = false
+	w.noteMgr.NotifyDeviceUnAvailable(w.specForDeviceId(id), w.zoneForDeviceId(id))
 
 	z := w.zoneForDeviceId(id)
 	if z.Armed {
 		w.alarm(id, alarm.Tamper, false)
 	}
-
-	// remove this device when it is deactivated and not available, by Jack Chen
-	delete(w.devices, id)
 }
 
 func (w *Waechter) DeviceAvailable(id device.Id) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	d, ok := w.devices[id]
 	if ok {
 		d.Active = true
@@ -470,6 +709,7 @@ func (w *Waechter) setArmMode(mode arm.Mode) {
 		w.syncZones()
 
 		w.updateActors(device.StateActor, w.state.stateActorPayload())
+		w.updateActors(device.SquawkActor, device.SquawkActorPayload{ArmMode: mode})
 
 		l := log.Info().Str("mode", string(mode))
 		if w.state.Armed() {
@@ -478,31 +718,37 @@ func (w *Waechter) setArmMode(mode arm.Mode) {
 		l.Msg("➔ System mode changed")
 		if w.state.Armed() {
 			go func() {
-				w.notificationBeep(false)
+				w.locked(func() { w.notificationBeep(false) })
 				for true {
-					if w.state.Armed() && w.isDuringExitDelay() {
-						r := config.General().ExitDelay - int(time.Now().Sub(w.state.ArmModeUpdated).Seconds())
-						if r > 0 {
-							log.Info().Int("remaining", r).Msg("Exit delay.")
-						}
-						time.Sleep(5 * time.Second)
-					} else {
-						if w.state.Armed() {
+					delayed := false
+					w.locked(func() {
+						if w.state.Armed() && w.isDuringExitDelay() {
+							delayed = true
+							r := config.General().ExitDelay - int(time.Now().Sub(w.state.ArmModeUpdated).Seconds())
+							if r > 0 {
+								log.Info().Int("remaining", r).Msg("Exit delay.")
+							}
+						} else if w.state.Armed() {
 							log.Info().Msg("Exit delay ended.")
+							w.updateActors(device.StateActor, w.state.stateActorPayload())
 							w.notificationBeep(true)
 						}
+					})
+					if !delayed {
 						return
 					}
+					time.Sleep(5 * time.Second)
 				}
 			}()
 		}
-		PersistState(w.state)
+		w.persistState()
 	}
 }
 
 func (w *Waechter) setAlarm(a alarm.Type) {
 	if w.state.Alarm != a {
 		w.state.Alarm = a
+		w.state.Silenced = false
 
 		w.updateActors(device.StateActor, w.state.stateActorPayload())
 		w.updateActors(device.AlarmActor, w.state.alarmActorPayload())
@@ -512,7 +758,7 @@ func (w *Waechter) setAlarm(a alarm.Type) {
 			l = l.Int("entryDelay", config.General().EntryDelay)
 		}
 		l.Msg("➔ Alarm changed")
-		PersistState(w.state)
+		w.persistState()
 	}
 }
 
@@ -539,14 +785,37 @@ func (w *Waechter) updateActor(id device.Id, actor device.Actor, payload any) {
 }
 
 func (w *Waechter) updateActors(actor device.Actor, payload any) {
+	handled := map[device.Id]bool{}
+	for _, c := range w.deviceConnectors {
+		gc, ok := c.(GroupActorConnector)
+		if !ok {
+			continue
+		}
+		var ids []device.Id
+		for _, d := range w.devices {
+			if d.Id.Prefix() == c.Id() && wslice.Contains(d.Spec.Actors, actor) {
+				ids = append(ids, d.Id)
+			}
+		}
+		if len(ids) > 0 {
+			for _, id := range gc.ControlActorGroup(ids, actor, payload) {
+				handled[id] = true
+			}
+		}
+	}
+
 	for i := range w.devices {
-		w.updateActor(i, actor, payload)
+		if !handled[i] {
+			w.updateActor(i, actor, payload)
+		}
 	}
 }
 
 func (w *Waechter) syncZones() {
 	for _, z := range w.zones {
-		if z.Perimeter {
+		if z.Bypassed {
+			z.Armed = false
+		} else if z.Perimeter {
 			z.Armed = w.state.Armed()
 		} else {
 			if w.state.Armed() && w.state.ArmMode != arm.Perimeter {
@@ -0,0 +1,179 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/zone"
+	"sort"
+	"sync"
+	"time"
+)
+
+// walkTestSensors are the sensors a device needs to be part of a walk test.
+var walkTestSensors = []device.Sensor{device.MotionSensor, device.ContactSensor, device.SmokeSensor, device.VibrationSensor, device.LockSensor, device.PanicSensor, device.FireSensor, device.TamperSensor}
+
+type WalkTestDevice struct {
+	Id          device.Id  `json:"id"`
+	DisplayName string     `json:"displayName"`
+	Zone        zone.Id    `json:"zone"`
+	Reported    *time.Time `json:"reported,omitempty"`
+}
+
+type WalkTestReport struct {
+	Started  time.Time        `json:"started"`
+	Ended    *time.Time       `json:"ended,omitempty"`
+	Reported []WalkTestDevice `json:"reported"`
+	Missing  []WalkTestDevice `json:"missing"`
+}
+
+type walkTest struct {
+	mutex    sync.Mutex
+	started  time.Time
+	reported map[device.Id]time.Time
+	timer    *time.Timer
+}
+
+// walkTestTrigger ticks off a device during a walk test. It returns true if the value is a trigger and
+// must not be evaluated any further.
+func (w *Waechter) walkTestTrigger(id device.Id, value any) bool {
+	wt := w.walkTest
+	if wt == nil || !device.IsTriggered(value) {
+		return false
+	}
+
+	wt.mutex.Lock()
+	_, known := wt.reported[id]
+	wt.reported[id] = time.Now()
+	wt.mutex.Unlock()
+
+	device.DInfo(w.devices[id]).Bool("first", !known).Msg("Walk test: device reported")
+	w.notificationBeep(false)
+	return true
+}
+
+// checkAdminPin works like checkPin but only accepts persons with admin rights.
+func (w *Waechter) checkAdminPin(id device.Id, enteredPin string) *config.Person {
+	person := w.checkPin(id, enteredPin)
+	if person != nil && !person.Admin {
+		log.Info().Str("name", person.Name).Msg("Person is not an admin")
+		return nil
+	}
+	return person
+}
+
+func (w *Waechter) startWalkTest(id device.Id, enteredPin string) bool {
+	person := w.checkAdminPin(id, enteredPin)
+	if person == nil {
+		return false
+	}
+	if w.state.Armed() || w.walkTest != nil {
+		log.Warn().Bool("armed", w.state.Armed()).Bool("walkTest", w.walkTest != nil).Msg("Could not start walk test")
+		return false
+	}
+
+	timeout := time.Duration(config.General().WalkTestTimeout) * time.Second
+	wt := &walkTest{
+		started:  time.Now(),
+		reported: map[device.Id]time.Time{},
+	}
+	wt.timer = time.AfterFunc(timeout, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if w.walkTest != wt {
+			return
+		}
+		log.Info().Dur("timeout", timeout).Msg("Walk test timed out")
+		w.endWalkTest()
+	})
+	w.walkTest = wt
+
+	log.Info().Str("name", person.Name).Dur("timeout", timeout).Msg("➔ Walk test started")
+	w.notificationBeep(true)
+	return true
+}
+
+func (w *Waechter) stopWalkTest(id device.Id, enteredPin string) bool {
+	person := w.checkAdminPin(id, enteredPin)
+	if person == nil || w.walkTest == nil {
+		return false
+	}
+	log.Info().Str("name", person.Name).Msg("Walk test stopped")
+	w.endWalkTest()
+	return true
+}
+
+func (w *Waechter) endWalkTest() {
+	wt := w.walkTest
+	if wt == nil {
+		return
+	}
+	wt.timer.Stop()
+	w.walkTest = nil
+
+	report := w.walkTestReport(wt)
+	now := time.Now()
+	report.Ended = &now
+	w.lastWalkTestReport = &report
+
+	for _, d := range report.Missing {
+		log.Warn().Str("_id", string(d.Id)).Str("_name", d.DisplayName).Msg("! Walk test: device did not report")
+	}
+	log.Info().Int("reported", len(report.Reported)).Int("missing", len(report.Missing)).Msg("➔ Walk test ended")
+	w.notificationBeep(true)
+	w.noteMgr.NotifyWalkTestReport(report)
+}
+
+func (w *Waechter) walkTestReport(wt *walkTest) WalkTestReport {
+	wt.mutex.Lock()
+	defer wt.mutex.Unlock()
+
+	report := WalkTestReport{
+		Started:  wt.started,
+		Reported: []WalkTestDevice{},
+		Missing:  []WalkTestDevice{},
+	}
+	for _, d := range w.devices {
+		if !wslice.ContainsAny(d.Spec.BaseSensors(), walkTestSensors) {
+			continue
+		}
+		entry := WalkTestDevice{
+			Id:          d.Id,
+			DisplayName: d.Spec.HumanReadableName(),
+			Zone:        d.Zone,
+		}
+		if t, ok := wt.reported[d.Id]; ok {
+			entry.Reported = &t
+			report.Reported = append(report.Reported, entry)
+		} else {
+			report.Missing = append(report.Missing, entry)
+		}
+	}
+	sort.Slice(report.Reported, func(i, j int) bool { return report.Reported[i].Reported.Before(*report.Reported[j].Reported) })
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Id < report.Missing[j].Id })
+	return report
+}
+
+func (w *Waechter) StartWalkTest(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.startWalkTest(systemDeviceId, pin)
+}
+
+func (w *Waechter) StopWalkTest(pin string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.stopWalkTest(systemDeviceId, pin)
+}
+
+// WalkTestReport returns the report of the running walk test or, if none is running, of the last one.
+func (w *Waechter) WalkTestReport() *WalkTestReport {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if wt := w.walkTest; wt != nil {
+		report := w.walkTestReport(wt)
+		return &report
+	}
+	return w.lastWalkTestReport
+}
@@ -9,6 +9,7 @@ type Zone struct {
 	DisplayName string `json:"displayName"`
 	Perimeter   bool   `json:"perimeter"`
 	Delayed     bool   `json:"delayed"`
+	Bypassed    bool   `json:"bypassed"`
 	Armed       bool   `json:"-"`
 }
 
@@ -26,6 +27,17 @@ const (
 	NoZone Id = ""
 )
 
+// UnassignedZone is used for devices that are not assigned to a configured zone. It is never armed.
+func UnassignedZone() Zone {
+	return Zone{
+		Id:          NoZone,
+		DisplayName: "unassigned",
+		Perimeter:   false,
+		Delayed:     false,
+		Armed:       false,
+	}
+}
+
 func SubstitutionZone(displayName string, armed bool) Zone {
 	return Zone{
 		Id:          "_",
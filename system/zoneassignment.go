@@ -0,0 +1,90 @@
+package system
+
+import (
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/internal/log"
+	"github.com/mtrossbach/waechter/internal/wslice"
+	"github.com/mtrossbach/waechter/system/device"
+	"github.com/mtrossbach/waechter/system/trouble"
+	"github.com/mtrossbach/waechter/system/zone"
+	"path"
+	"strings"
+)
+
+// assignZone returns the zone of a device. An explicit entry in the device list takes precedence over the zone
+// assigned during pairing and the zone rules, which are evaluated in order. Devices matching nothing stay unassigned.
+func (w *Waechter) assignZone(spec device.Spec) zone.Id {
+	for _, dc := range config.Devices() {
+		if device.Id(dc.Id) == spec.Id {
+			return zone.Id(dc.Zone)
+		}
+	}
+	for _, dc := range config.Devices() {
+		if wslice.Contains(spec.FormerIds, device.Id(dc.Id)) {
+			log.Warn().Str("id", string(spec.Id)).Str("former", dc.Id).Msg("Device list entry uses a former id, please update it")
+			return zone.Id(dc.Zone)
+		}
+	}
+	if e, ok := w.registry.get(spec.Id); ok && len(e.AssignedZone) > 0 {
+		return e.AssignedZone
+	}
+	for _, r := range config.ZoneRules() {
+		if zoneRuleMatches(r, spec) {
+			return zone.Id(r.Zone)
+		}
+	}
+	return zone.NoZone
+}
+
+// zoneRuleMatches returns true if all criteria of the rule match the device. A rule without criteria matches nothing.
+func zoneRuleMatches(r config.ZoneRuleConfig, spec device.Spec) bool {
+	if r.Connector == "" && r.Name == "" && r.Regex == "" && r.IeeeAddress == "" && r.Area == "" {
+		return false
+	}
+	if r.Connector != "" && r.Connector != spec.Id.Prefix() {
+		return false
+	}
+	if r.Name != "" {
+		// the pattern is validated when the configuration is loaded
+		if ok, _ := path.Match(r.Name, spec.Id.Entity()); !ok {
+			return false
+		}
+	}
+	if r.Regex != "" {
+		re := r.CompiledRegex()
+		if re == nil || !re.MatchString(spec.Id.Entity()) {
+			return false
+		}
+	}
+	if r.IeeeAddress != "" && !strings.EqualFold(r.IeeeAddress, spec.IeeeAddress) {
+		return false
+	}
+	if r.Area != "" && !strings.EqualFold(r.Area, spec.Area) {
+		return false
+	}
+	return true
+}
+
+// updateZone assigns the zone of a discovered device.
+func (w *Waechter) updateZone(d *device.Device) {
+	d.Zone = w.assignZone(d.Spec)
+	w.checkZone(d)
+}
+
+// zonedSensors detect intrusions only while the zone of their device is armed.
+var zonedSensors = []device.Sensor{device.MotionSensor, device.ContactSensor, device.VibrationSensor, device.LockSensor}
+
+// checkZone raises a trouble if a device with intrusion sensors is not assigned to a known zone. Devices without
+// (keypads, sirens, ...) work the same in every zone.
+func (w *Waechter) checkZone(d *device.Device) {
+	if _, ok := w.zones[d.Zone]; ok || !wslice.ContainsAny(d.Spec.BaseSensors(), zonedSensors) {
+		w.clearTrouble(trouble.UnassignedDevice, string(d.Id))
+		return
+	}
+	if d.Zone == zone.NoZone {
+		device.DError(d).Msg("! Device is not assigned to any zone and will not be armed!")
+	} else {
+		device.DError(d).Msg("! Device is assigned to an unknown zone and will not be armed!")
+	}
+	w.raiseTrouble(trouble.UnassignedDevice, string(d.Id))
+}
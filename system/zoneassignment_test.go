@@ -0,0 +1,62 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/mtrossbach/waechter/internal/config"
+	"github.com/mtrossbach/waechter/system/device"
+)
+
+func TestZoneRuleMatches(t *testing.T) {
+	spec := device.Spec{Id: "z2m::Door Hall", IeeeAddress: "0x00158d0001a2b3c4", Area: "Hall"}
+
+	tests := []struct {
+		name string
+		rule config.ZoneRuleConfig
+		want bool
+	}{
+		{name: "no criteria", rule: config.ZoneRuleConfig{Zone: "hall"}, want: false},
+		{name: "connector", rule: config.ZoneRuleConfig{Connector: "z2m"}, want: true},
+		{name: "other connector", rule: config.ZoneRuleConfig{Connector: "ha"}, want: false},
+		{name: "name glob", rule: config.ZoneRuleConfig{Name: "Door*"}, want: true},
+		{name: "name glob mismatch", rule: config.ZoneRuleConfig{Name: "Window*"}, want: false},
+		{name: "regex", rule: config.ZoneRuleConfig{Regex: "(?i)hall$"}, want: true},
+		{name: "regex mismatch", rule: config.ZoneRuleConfig{Regex: "^Window"}, want: false},
+		{name: "ieee address ignores case", rule: config.ZoneRuleConfig{IeeeAddress: "0x00158D0001A2B3C4"}, want: true},
+		{name: "area ignores case", rule: config.ZoneRuleConfig{Area: "hall"}, want: true},
+		{name: "other area", rule: config.ZoneRuleConfig{Area: "Kitchen"}, want: false},
+		{name: "all criteria", rule: config.ZoneRuleConfig{Connector: "z2m", Name: "Door*", Area: "Hall"}, want: true},
+		{name: "one criterion fails", rule: config.ZoneRuleConfig{Connector: "z2m", Name: "Door*", Area: "Kitchen"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Compile(); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if got := zoneRuleMatches(tt.rule, spec); got != tt.want {
+				t.Errorf("zoneRuleMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoneRuleCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    config.ZoneRuleConfig
+		wantErr bool
+	}{
+		{name: "valid", rule: config.ZoneRuleConfig{Name: "Door*", Regex: "^Door"}},
+		{name: "invalid glob", rule: config.ZoneRuleConfig{Name: "Door["}, wantErr: true},
+		{name: "invalid regex", rule: config.ZoneRuleConfig{Regex: "Door("}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Compile(); (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}